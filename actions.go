@@ -6,8 +6,10 @@ import (
 	"os"
 )
 
-func (m *Model) submitAction(doFn ActionFunction, undoFn ActionFunction) {
-	m.pendingActions <- Action{doFn, undoFn}
+// submitAction queues an action for the audio thread, consecutive
+// actions with the same non-zero burst are undone together
+func (m *Model) submitAction(doFn ActionFunction, undoFn ActionFunction, burst int) {
+	m.pendingActions <- Action{doFn: doFn, undoFn: undoFn, burst: burst}
 }
 
 func (m *Model) fix() {
@@ -143,6 +145,16 @@ func (m *Model) PageDown() {
 	m.moveBrush(0, max(m.song.LPB, m.brush.H))
 }
 
+func (m *Model) PrevBar() {
+	p := m.song.Patterns[m.editPattern]
+	m.moveBrush(0, -max(m.GetRowsPerBar(p), m.brush.H))
+}
+
+func (m *Model) NextBar() {
+	p := m.song.Patterns[m.editPattern]
+	m.moveBrush(0, max(m.GetRowsPerBar(p), m.brush.H))
+}
+
 func (m *Model) JumpToFirstRow() {
 	m.moveBrush(0, -m.brush.Y)
 }
@@ -165,10 +177,18 @@ func (m *Model) JumpToBottomRight() {
 }
 
 func (m *Model) Left() {
+	if m.smartCursor && m.brush.W == 1 && m.mode != DefaultsMode {
+		m.smartMove(-1)
+		return
+	}
 	m.moveBrush(-m.brush.W, 0)
 }
 
 func (m *Model) Right() {
+	if m.smartCursor && m.brush.W == 1 && m.mode != DefaultsMode {
+		m.smartMove(1)
+		return
+	}
 	m.moveBrush(m.brush.W, 0)
 }
 
@@ -218,15 +238,20 @@ func (m *Model) DecBrushWidth() {
 
 func (m *Model) stepBrushHeight(expandDir int) {
 	p := m.song.Patterns[m.editPattern]
+	rowsPerBar := min(m.GetRowsPerBar(p), p.Height())
 	if expandDir == m.brush.ExpandDir.Y {
 		switch {
 		case m.brush.H < m.song.LPB:
 			m.brush.H = m.song.LPB
+		case m.brush.H < rowsPerBar:
+			m.brush.H = rowsPerBar
 		default:
 			m.brush.H = p.Height()
 		}
 	} else {
 		switch {
+		case m.brush.H > rowsPerBar:
+			m.brush.H = rowsPerBar
 		case m.brush.H > m.song.LPB:
 			m.brush.H = m.song.LPB
 		case m.brush.H > 1:
@@ -339,6 +364,7 @@ func (m *Model) InsertBlock() {
 		func() {
 			m.ReplaceEditPattern(p)
 		},
+		0,
 	)
 }
 
@@ -387,6 +413,7 @@ func (m *Model) DeleteBlock(backspace bool) {
 			m.brush = oldBrush
 			m.editPos = oldEditPos
 		},
+		0,
 	)
 }
 
@@ -401,6 +428,7 @@ func (m *Model) ZeroBlock() {
 		func() {
 			m.ReplaceEditPattern(p)
 		},
+		0,
 	)
 }
 
@@ -408,17 +436,25 @@ func (m *Model) CurrentTrack() int {
 	return m.editPos.X / 6
 }
 
+func (m *Model) CurrentTrackSettings() *TrackSettings {
+	p := m.song.Patterns[m.editPattern]
+	return &p.TrackSettings[m.CurrentTrack()]
+}
+
 func (m *Model) InsertTrack() {
 	p := m.song.Patterns[m.editPattern]
 	at := m.CurrentTrack()
 	clone := p.insertTracks(at, 1)
+	states := m.allocTrackStates(clone.NumTracks)
 	m.submitAction(
 		func() {
+			m.useTrackStates(states)
 			m.ReplaceEditPattern(clone)
 		},
 		func() {
 			m.ReplaceEditPattern(p)
 		},
+		0,
 	)
 }
 
@@ -436,6 +472,7 @@ func (m *Model) DeleteTrack() {
 		func() {
 			m.ReplaceEditPattern(p)
 		},
+		0,
 	)
 }
 
@@ -443,16 +480,20 @@ func (m *Model) Cut() {
 	p := m.song.Patterns[m.editPattern]
 	sel := m.sel
 	block := p.getBlock(sel)
+	attrs := p.getAttrs(sel)
 	m.submitAction(
 		func() {
 			m.clipboard = block
+			m.clipboardAttrs = attrs
 			m.pasteOffset = sel.X % 6
 			p.zeroBlock(sel)
 		},
 		func() {
 			p := m.song.Patterns[m.editPattern]
 			p.setBlock(sel, block)
+			p.setAttrs(sel, attrs)
 		},
+		0,
 	)
 }
 
@@ -460,16 +501,19 @@ func (m *Model) Copy() {
 	p := m.song.Patterns[m.editPattern]
 	sel := m.sel
 	block := p.getBlock(sel)
+	attrs := p.getAttrs(sel)
 	m.submitAction(
 		func() {
 			m.clipboard = block
+			m.clipboardAttrs = attrs
 			m.pasteOffset = sel.X % 6
 		},
 		nil,
+		0,
 	)
 }
 
-func (m *Model) pasteBlock(pos Point, block Block) (prevBlock Block) {
+func (m *Model) pasteBlock(pos Point, block Block, attrs [][]CellAttrs) (prevBlock Block, prevAttrs [][]CellAttrs) {
 	if block == nil {
 		return
 	}
@@ -497,20 +541,24 @@ func (m *Model) pasteBlock(pos Point, block Block) (prevBlock Block) {
 		rect.H = patternHeight - rect.Y
 	}
 	prevBlock = p.getBlock(rect)
+	prevAttrs = p.getAttrs(rect)
 	p.setBlock(rect, block)
-	return prevBlock
+	p.setAttrs(rect, attrs)
+	return prevBlock, prevAttrs
 }
 
 func (m *Model) Paste() {
 	var prevBlock Block
+	var prevAttrs [][]CellAttrs
 	pos := m.editPos
 	m.submitAction(
 		func() {
-			prevBlock = m.pasteBlock(pos, m.clipboard)
+			prevBlock, prevAttrs = m.pasteBlock(pos, m.clipboard, m.clipboardAttrs)
 		},
 		func() {
-			m.pasteBlock(pos, prevBlock)
+			m.pasteBlock(pos, prevBlock, prevAttrs)
 		},
+		0,
 	)
 }
 
@@ -525,6 +573,7 @@ func (m *Model) PlayOrStop() {
 			}
 		},
 		nil,
+		0,
 	)
 }
 
@@ -537,6 +586,7 @@ func (m *Model) SetPlayFromRow() {
 			}
 		},
 		nil,
+		0,
 	)
 }
 
@@ -558,31 +608,52 @@ func FixSong(song *Song) {
 	if song.Root == 0 {
 		song.Root = 60
 	}
+	if song.BeatsPerBar == 0 {
+		song.BeatsPerBar = 4
+	}
+	if song.BeatUnit == 0 {
+		song.BeatUnit = 4
+	}
+	for _, p := range song.Patterns {
+		if p != nil {
+			p.fix()
+		}
+	}
 }
 
 func (m *Model) LoadSong() {
 	if m.filename == "" {
 		return
 	}
-	b, err := os.ReadFile(m.filename)
+	song, err := readSong(m.filename)
 	if err != nil {
 		m.SetError(err)
 		return
 	}
-	song := &Song{}
-	if err := json.Unmarshal(b, song); err != nil {
-		m.SetError(err)
-		return
-	}
-	FixSong(song)
+	states := makeTrackStates(song.maxNumTracks())
 	m.submitAction(
 		func() {
 			m.SetSong(song)
+			m.trackStates = states
 		},
 		nil,
+		0,
 	)
 }
 
+func readSong(filename string) (*Song, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	song := &Song{}
+	if err := json.Unmarshal(b, song); err != nil {
+		return nil, err
+	}
+	FixSong(song)
+	return song, nil
+}
+
 func (m *Model) SaveSong() {
 	if m.filename == "" {
 		m.SetError(fmt.Errorf("no filename"))
@@ -606,7 +677,7 @@ func (m *Model) Undo() {
 	lastAction := m.undoableActions[len(m.undoableActions)-1]
 	m.undoableActions = m.undoableActions[:len(m.undoableActions)-1]
 	m.undoneActions = append(m.undoneActions, lastAction)
-	m.submitAction(lastAction.undoFn, nil)
+	m.submitAction(lastAction.undoFn, nil, 0)
 }
 
 func (m *Model) Redo() {
@@ -615,5 +686,22 @@ func (m *Model) Redo() {
 	}
 	lastAction := m.undoneActions[len(m.undoneActions)-1]
 	m.undoneActions = m.undoneActions[:len(m.undoneActions)-1]
-	m.submitAction(lastAction.doFn, lastAction.undoFn)
+	m.submitAction(lastAction.doFn, lastAction.undoFn, 0)
+}
+
+func (m *Model) SetTrackDefaultsDigit(b byte) {
+	p := m.song.Patterns[m.editPattern]
+	t := m.editPos.X / 6
+	prevDefaults := p.TrackDefaults[t]
+	defaults := prevDefaults
+	defaults.setDigit(m.editPos.X%6, b)
+	m.submitAction(
+		func() {
+			m.song.Patterns[m.editPattern].TrackDefaults[t] = defaults
+		},
+		func() {
+			m.song.Patterns[m.editPattern].TrackDefaults[t] = prevDefaults
+		},
+		0,
+	)
 }
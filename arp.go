@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+type ArpOrder int
+
+const (
+	ArpOff ArpOrder = iota
+	ArpUp
+	ArpDown
+	ArpUpDown
+	ArpRandom
+	ArpPlayed
+)
+
+var arpOrderNames = []string{"off", "up", "down", "updown", "random", "played"}
+
+func (o ArpOrder) String() string {
+	return arpOrderNames[o]
+}
+
+func parseArpOrder(s string) (ArpOrder, error) {
+	if i := slices.Index(arpOrderNames, s); i >= 0 {
+		return ArpOrder(i), nil
+	}
+	return ArpOff, fmt.Errorf("invalid arp order: %s", s)
+}
+
+func (o ArpOrder) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+func (o *ArpOrder) UnmarshalText(text []byte) error {
+	order, err := parseArpOrder(string(text))
+	if err != nil {
+		return err
+	}
+	*o = order
+	return nil
+}
+
+type arpNote struct {
+	track    int
+	note     byte
+	velocity byte
+	channel  byte
+}
+
+// getArpTrack returns the track whose arpeggiator takes the notes of
+// numTrack or -1 if the notes of numTrack shall be played as they are
+func (m *Model) getArpTrack(p *Pattern, numTrack int) int {
+	for t := numTrack; t >= 0; t-- {
+		settings := &p.TrackSettings[t]
+		if settings.ArpOrder != ArpOff && numTrack < t+max(1, settings.ArpTracks) {
+			return t
+		}
+	}
+	return -1
+}
+
+func (m *Model) holdArpNote(ts *TrackState, numTrack int, msg MidiMessage) {
+	i := slices.IndexFunc(ts.arpHeld, func(n arpNote) bool {
+		return n.track == numTrack
+	})
+	if msg[0]>>4 == 0x8 || msg[2] == 0 {
+		if i >= 0 && ts.arpHeld[i].note == msg[1] {
+			ts.arpHeld = slices.Delete(ts.arpHeld, i, i+1)
+			ts.arpChanged = true
+		}
+		return
+	}
+	if i >= 0 {
+		ts.arpHeld = slices.Delete(ts.arpHeld, i, i+1)
+	}
+	if len(ts.arpHeld) == 0 {
+		ts.arpTick = 0
+		ts.arpStep = 0
+	}
+	ts.arpHeld = append(ts.arpHeld, arpNote{numTrack, msg[1], msg[2], msg[0] & 0x0f})
+	ts.arpChanged = true
+}
+
+// appendArpSequence builds the arpeggio of the held notes into seq[:0]
+func appendArpSequence(seq, held []arpNote, order ArpOrder, octaves int) []arpNote {
+	seq = append(seq[:0], held...)
+	if order != ArpPlayed {
+		slices.SortStableFunc(seq, func(a, b arpNote) int {
+			return int(a.note) - int(b.note)
+		})
+	}
+	base := seq[:len(held)]
+	for octave := 1; octave < octaves; octave++ {
+		for _, n := range base {
+			note := int(n.note) + octave*12
+			if note <= 127 {
+				n.note = byte(note)
+				seq = append(seq, n)
+			}
+		}
+	}
+	switch order {
+	case ArpDown:
+		slices.Reverse(seq)
+	case ArpUpDown:
+		for i := len(seq) - 2; i > 0; i-- {
+			seq = append(seq, seq[i])
+		}
+	}
+	return seq
+}
+
+func (m *Model) arpNoteOff(ts *TrackState, emit func(MidiMessage)) {
+	if ts.arpNote >= 0 {
+		emit(MidiMessage{0x80 | ts.arpChannel, byte(ts.arpNote), 0})
+		ts.arpNote = -1
+	}
+}
+
+// releaseArpNotes ends the sounding arpeggio notes when playback stops
+func (m *Model) releaseArpNotes() {
+	for i := range m.trackStates {
+		m.arpNoteOff(&m.trackStates[i], func(msg MidiMessage) {
+			m.releaseMessages = append(m.releaseMessages, msg)
+		})
+	}
+}
+
+func (m *Model) updateArp(p *Pattern, numTrack int, ts *TrackState, emit func(MidiMessage)) {
+	settings := &p.TrackSettings[numTrack]
+	if settings.ArpOrder == ArpOff || len(ts.arpHeld) == 0 {
+		m.arpNoteOff(ts, emit)
+		return
+	}
+	rate := settings.ArpRate
+	if rate <= 0 {
+		rate = m.GetTrackTPL(p, numTrack)
+	}
+	gate := settings.ArpGate
+	if gate <= 0 {
+		gate = 50
+	}
+	tick := ts.arpTick % rate
+	if tick == 0 {
+		m.arpNoteOff(ts, emit)
+		if ts.arpChanged || ts.arpSeqOrder != settings.ArpOrder || ts.arpSeqOcts != settings.ArpOctaves {
+			ts.arpSeq = appendArpSequence(ts.arpSeq, ts.arpHeld, settings.ArpOrder, settings.ArpOctaves)
+			ts.arpSeqOrder = settings.ArpOrder
+			ts.arpSeqOcts = settings.ArpOctaves
+			ts.arpChanged = false
+		}
+		seq := ts.arpSeq
+		var n arpNote
+		if settings.ArpOrder == ArpRandom {
+			n = seq[m.rng.Intn(len(seq))]
+		} else {
+			n = seq[ts.arpStep%len(seq)]
+		}
+		ts.arpStep++
+		emit(MidiMessage{0x90 | n.channel, n.note, n.velocity})
+		ts.arpNote = int(n.note)
+		ts.arpChannel = n.channel
+	} else if tick >= max(1, rate*gate/100) {
+		m.arpNoteOff(ts, emit)
+	}
+	ts.arpTick++
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Chord struct {
+	Name      string
+	Degrees   []int // scale degrees above the root (diatonic chords)
+	Intervals []int // semitones above the root (named chords)
+	Inversion int
+}
+
+var diatonicChords = map[string][]int{
+	"triad": {0, 2, 4},
+	"7th":   {0, 2, 4, 6},
+	"9th":   {0, 2, 4, 6, 8},
+	"sus2":  {0, 1, 4},
+	"sus4":  {0, 3, 4},
+	"power": {0, 4},
+}
+
+var namedChords = map[string][]int{
+	"maj":  {0, 4, 7},
+	"min":  {0, 3, 7},
+	"dim":  {0, 3, 6},
+	"aug":  {0, 4, 8},
+	"maj7": {0, 4, 7, 11},
+	"min7": {0, 3, 7, 10},
+	"dom7": {0, 4, 7, 10},
+	"dim7": {0, 3, 6, 9},
+}
+
+var defaultChord = Chord{Name: "triad", Degrees: diatonicChords["triad"]}
+
+// parseChord parses a chord name with an optional inversion suffix,
+// e.g. "triad", "7th/1" or "min7/2"
+func parseChord(s string) (Chord, error) {
+	name, inversionString, hasInversion := strings.Cut(s, "/")
+	chord := Chord{Name: name}
+	if degrees, ok := diatonicChords[name]; ok {
+		chord.Degrees = degrees
+	} else if intervals, ok := namedChords[name]; ok {
+		chord.Intervals = intervals
+	} else {
+		return Chord{}, fmt.Errorf("invalid chord: %s", s)
+	}
+	if hasInversion {
+		inversion, err := strconv.Atoi(inversionString)
+		if err != nil || inversion < 0 || inversion >= chord.size() {
+			return Chord{}, fmt.Errorf("invalid inversion: %s", inversionString)
+		}
+		chord.Inversion = inversion
+	}
+	return chord, nil
+}
+
+func (c Chord) size() int {
+	if c.Intervals != nil {
+		return len(c.Intervals)
+	}
+	return len(c.Degrees)
+}
+
+func (c Chord) String() string {
+	if c.Inversion == 0 {
+		return c.Name
+	}
+	return fmt.Sprintf("%s/%d", c.Name, c.Inversion)
+}
+
+// ChordNotes returns the notes of the chord built on root, lowest first
+func (m *Model) ChordNotes(c Chord, root int) []int {
+	notes := make([]int, 0, c.size())
+	if c.Intervals != nil {
+		for _, interval := range c.Intervals {
+			notes = append(notes, root+interval)
+		}
+	} else {
+		degree, offset := m.MidiNoteToDegree(root)
+		for _, d := range c.Degrees {
+			notes = append(notes, m.DegreeToMidiNote(degree+d)+offset)
+		}
+	}
+	for i := range c.Inversion {
+		notes[i] += 12
+	}
+	notes = append(notes[c.Inversion:], notes[:c.Inversion]...)
+	for i := range notes {
+		notes[i] = max(0, min(notes[i], 127))
+	}
+	return notes
+}
+
+func (m *Model) ToggleChordMode() {
+	m.chordMode = !m.chordMode
+	if m.chord.Name == "" {
+		m.chord = defaultChord
+	}
+}
+
+// EnterChord writes the notes of the current chord built on root into
+// consecutive tracks starting at the current one
+func (m *Model) EnterChord(root int) []int {
+	p := m.song.Patterns[m.editPattern]
+	firstTrack := m.CurrentTrack()
+	notes := m.ChordNotes(m.chord, root)
+	notes = notes[:min(len(notes), p.NumTracks-firstTrack)]
+	y := m.editPos.Y
+	prevMsgs := make([]MidiMessage, len(notes))
+	msgs := make([]MidiMessage, len(notes))
+	for i, note := range notes {
+		prevMsgs[i] = p.Rows[y][firstTrack+i]
+		msgs[i] = prevMsgs[i]
+		msgs[i][1] = byte(note)
+		if m.entryVelocity > 0 {
+			msgs[i][2] = byte(m.entryVelocity)
+		}
+	}
+	m.submitAction(
+		func() {
+			p := m.song.Patterns[m.editPattern]
+			copy(p.Rows[y][firstTrack:], msgs)
+		},
+		func() {
+			p := m.song.Patterns[m.editPattern]
+			copy(p.Rows[y][firstTrack:], prevMsgs)
+		},
+		0,
+	)
+	return notes
+}
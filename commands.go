@@ -11,6 +11,43 @@ func parseInt(s string) (int, error) {
 	return int(i), err
 }
 
+func parseRatio(s string) (float64, error) {
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		n, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return 0, err
+		}
+		d, err := strconv.ParseFloat(den, 64)
+		if err != nil {
+			return 0, err
+		}
+		if d == 0 {
+			return 0, fmt.Errorf("invalid ratio: %s", s)
+		}
+		return n / d, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseTimeSignature(s string) (beatsPerBar, beatUnit int, err error) {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		den = "4"
+	}
+	beatsPerBar, err = parseInt(num)
+	if err != nil {
+		return 0, 0, err
+	}
+	beatUnit, err = parseInt(den)
+	if err != nil {
+		return 0, 0, err
+	}
+	if beatsPerBar < 1 || beatsPerBar > 255 || beatUnit < 1 || beatUnit > 64 || beatUnit&(beatUnit-1) != 0 {
+		return 0, 0, fmt.Errorf("invalid time signature: %s", s)
+	}
+	return beatsPerBar, beatUnit, nil
+}
+
 func (m *Model) ExecuteCommand(command string) {
 	items := strings.Fields(command)
 	if len(items) == 0 {
@@ -27,6 +64,15 @@ func (m *Model) ExecuteCommand(command string) {
 			m.filename = items[1]
 		}
 		m.SaveSong()
+	case "export":
+		if len(items) < 2 {
+			m.SetError(fmt.Errorf("no filename"))
+			return
+		}
+		if err := m.ExportSMF(items[1]); err != nil {
+			m.SetError(err)
+			return
+		}
 	case "bpm":
 		if len(items) > 1 {
 			bpm, err := parseInt(items[1])
@@ -39,6 +85,8 @@ func (m *Model) ExecuteCommand(command string) {
 				return
 			}
 			m.song.BPM = bpm
+			m.playBPM = bpm
+			m.invalidatePatternDurations()
 		}
 	case "lpb":
 		if len(items) > 1 {
@@ -52,6 +100,8 @@ func (m *Model) ExecuteCommand(command string) {
 				return
 			}
 			m.song.LPB = lpb
+			m.playLPB = lpb
+			m.invalidatePatternDurations()
 		}
 	case "tpl":
 		if len(items) > 1 {
@@ -65,6 +115,492 @@ func (m *Model) ExecuteCommand(command string) {
 				return
 			}
 			m.song.TPL = tpl
+			m.playTPL = tpl
+			m.invalidatePatternDurations()
+		}
+	case "sig":
+		if len(items) > 1 {
+			beatsPerBar, beatUnit, err := parseTimeSignature(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			m.song.BeatsPerBar = beatsPerBar
+			m.song.BeatUnit = beatUnit
+		}
+	case "psig":
+		if len(items) > 1 {
+			p := m.song.Patterns[m.editPattern]
+			if items[1] == "-" {
+				p.BeatsPerBar = 0
+				p.BeatUnit = 0
+				return
+			}
+			beatsPerBar, beatUnit, err := parseTimeSignature(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			p.BeatsPerBar = beatsPerBar
+			p.BeatUnit = beatUnit
+		}
+	case "swing":
+		if len(items) > 1 {
+			swing, err := parseInt(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			if swing < 0 || swing > 100 {
+				m.SetError(fmt.Errorf("invalid swing: %d", swing))
+				return
+			}
+			m.song.Swing = swing
+		}
+	case "pswing":
+		if len(items) > 1 {
+			p := m.song.Patterns[m.editPattern]
+			if items[1] == "-" {
+				p.Swing = nil
+				return
+			}
+			swing, err := parseInt(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			if swing < 0 || swing > 100 {
+				m.SetError(fmt.Errorf("invalid swing: %d", swing))
+				return
+			}
+			p.Swing = &swing
+		}
+	case "groove":
+		if len(items) > 1 {
+			if items[1] == "-" {
+				m.song.Groove = nil
+				return
+			}
+			groove, err := LoadGroove(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			m.song.Groove = groove
+		}
+	case "bendrange":
+		if len(items) > 1 {
+			bendRange, err := parseInt(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			if bendRange < 1 || bendRange > 24 {
+				m.SetError(fmt.Errorf("invalid bend range: %d", bendRange))
+				return
+			}
+			m.CurrentTrackSettings().BendRange = bendRange
+		}
+	case "glide":
+		if len(items) > 1 {
+			glide, err := parseInt(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			if glide < 0 {
+				m.SetError(fmt.Errorf("invalid glide: %d", glide))
+				return
+			}
+			m.CurrentTrackSettings().Glide = glide
+		}
+	case "vibrato", "vib":
+		if len(items) > 1 {
+			speed, err := parseInt(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			if speed < 0 {
+				m.SetError(fmt.Errorf("invalid vibrato speed: %d", speed))
+				return
+			}
+			settings := m.CurrentTrackSettings()
+			if len(items) > 2 {
+				depth, err := parseInt(items[2])
+				if err != nil {
+					m.SetError(err)
+					return
+				}
+				if depth < 0 {
+					m.SetError(fmt.Errorf("invalid vibrato depth: %d", depth))
+					return
+				}
+				settings.VibratoDepth = depth
+			}
+			settings.VibratoSpeed = speed
+		}
+	case "slide":
+		if len(items) > 1 {
+			slide, err := parseInt(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			if slide < 0 {
+				m.SetError(fmt.Errorf("invalid slide: %d", slide))
+				return
+			}
+			m.CurrentTrackSettings().Slide = slide
+		}
+	case "arp":
+		if len(items) > 1 {
+			order, err := parseArpOrder(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			var params [4]int
+			names := []string{"octaves", "rate", "gate", "tracks"}
+			for i, item := range items[2:min(len(items), 6)] {
+				value, err := parseInt(item)
+				if err != nil {
+					m.SetError(err)
+					return
+				}
+				if value < 0 {
+					m.SetError(fmt.Errorf("invalid arp %s: %d", names[i], value))
+					return
+				}
+				params[i] = value
+			}
+			settings := m.CurrentTrackSettings()
+			settings.ArpOrder = order
+			settings.ArpOctaves = params[0]
+			settings.ArpRate = params[1]
+			settings.ArpGate = params[2]
+			settings.ArpTracks = params[3]
+		}
+	case "echo":
+		if len(items) > 1 {
+			settings := m.CurrentTrackSettings()
+			if items[1] == "off" {
+				settings.EchoRepeats = 0
+				return
+			}
+			var params [4]int
+			names := []string{"repeats", "delay", "feedback", "transpose"}
+			for i, item := range items[1:min(len(items), 5)] {
+				value, err := parseInt(item)
+				if err != nil {
+					m.SetError(err)
+					return
+				}
+				if value < 0 && names[i] != "transpose" {
+					m.SetError(fmt.Errorf("invalid echo %s: %d", names[i], value))
+					return
+				}
+				params[i] = value
+			}
+			if params[0] > 0 && params[1] == 0 {
+				m.SetError(fmt.Errorf("missing echo delay"))
+				return
+			}
+			settings.EchoRepeats = params[0]
+			settings.EchoDelay = params[1]
+			settings.EchoFeedback = params[2]
+			settings.EchoTranspose = params[3]
+		}
+	case "bakeecho":
+		m.BakeEcho()
+	case "tracklen", "tlen":
+		if len(items) > 1 {
+			length, err := parseInt(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			if length < 0 {
+				m.SetError(fmt.Errorf("invalid track length: %d", length))
+				return
+			}
+			m.CurrentTrackSettings().Length = length
+		}
+	case "tracktpl", "ttpl":
+		if len(items) > 1 {
+			mul, err := parseRatio(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			if mul < 0 {
+				m.SetError(fmt.Errorf("invalid TPL multiplier: %s", items[1]))
+				return
+			}
+			m.CurrentTrackSettings().TPLMul = mul
+		}
+	case "cond":
+		if len(items) > 1 {
+			cond, err := parseCondition(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			m.SetCondition(cond)
+		}
+	case "gate":
+		if len(items) > 1 {
+			rows, ticks, err := parseGate(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			m.SetGate(rows, ticks)
+		}
+	case "mono":
+		settings := m.CurrentTrackSettings()
+		if len(items) > 1 {
+			switch items[1] {
+			case "on":
+				settings.Mono = true
+			case "off":
+				settings.Mono = false
+			default:
+				m.SetError(fmt.Errorf("invalid mono mode: %s", items[1]))
+			}
+		} else {
+			settings.Mono = !settings.Mono
+		}
+	case "seed":
+		if len(items) > 1 {
+			seed, err := parseInt(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			m.song.Seed = int64(seed)
+		}
+	case "transpose", "tr":
+		if len(items) > 1 {
+			amount, byDegrees := items[1], false
+			if s, ok := strings.CutSuffix(amount, "d"); ok {
+				amount, byDegrees = s, true
+			}
+			n, err := parseInt(amount)
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			m.TransposeSelection(n, byDegrees)
+		}
+	case "interpolate", "interp":
+		curve := CurveLinear
+		if len(items) > 1 {
+			var err error
+			curve, err = parseCurve(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+		}
+		m.InterpolateSelection(curve)
+	case "lfo":
+		lfo, err := m.parseLFO(items[1:])
+		if err != nil {
+			m.SetError(err)
+			return
+		}
+		m.GenerateLFO(lfo)
+	case "euclid":
+		if len(items) < 3 {
+			m.SetError(fmt.Errorf("usage: euclid <k> <n> [rotate]"))
+			return
+		}
+		k, err := parseInt(items[1])
+		if err != nil {
+			m.SetError(err)
+			return
+		}
+		n, err := parseInt(items[2])
+		if err != nil {
+			m.SetError(err)
+			return
+		}
+		if n < 1 || k < 0 || k > n {
+			m.SetError(fmt.Errorf("invalid euclidean rhythm: %d/%d", k, n))
+			return
+		}
+		rotate := 0
+		if len(items) > 3 {
+			rotate, err = parseInt(items[3])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+		}
+		m.GenerateSteps(euclid(k, n, rotate))
+	case "steps":
+		if len(items) > 1 {
+			steps, err := parseSteps(strings.Join(items[1:], ""))
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			m.GenerateSteps(steps)
+		}
+	case "melody":
+		params, err := m.parseMelodyParams(items[1:])
+		if err != nil {
+			m.SetError(err)
+			return
+		}
+		m.GenerateMelody(params)
+	case "humanize", "hum":
+		if len(items) > 1 {
+			velocityAmount, err := parseInt(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			delayAmount := 0
+			if len(items) > 2 {
+				delayAmount, err = parseInt(items[2])
+				if err != nil {
+					m.SetError(err)
+					return
+				}
+			}
+			seed := m.song.Seed
+			if len(items) > 3 {
+				n, err := parseInt(items[3])
+				if err != nil {
+					m.SetError(err)
+					return
+				}
+				seed = int64(n)
+			}
+			if velocityAmount < 0 || delayAmount < 0 {
+				m.SetError(fmt.Errorf("invalid humanize amount"))
+				return
+			}
+			m.HumanizeSelection(velocityAmount, delayAmount, seed)
+		}
+	case "reverse", "rev":
+		m.ReverseSelection()
+	case "rotate", "rot":
+		n := 1
+		if len(items) > 1 {
+			var err error
+			n, err = parseInt(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+		}
+		m.RotateSelection(n)
+	case "invert", "inv":
+		pivot := -1
+		if len(items) > 1 {
+			var err error
+			pivot, _, err = m.parseNote(items[1])
+			if err != nil {
+				pivot, err = parseInt(items[1])
+			}
+			if err != nil || pivot < 0 || pivot > 127 {
+				m.SetError(fmt.Errorf("invalid pivot: %s", items[1]))
+				return
+			}
+		}
+		m.InvertSelection(pivot)
+	case "smart":
+		m.ToggleSmartCursor()
+	case "lint":
+		m.Lint()
+	case "consolidate":
+		m.Consolidate(m.getCommandRect(len(items) > 1 && items[1] == "all"))
+	case "minimize":
+		m.Minimize(m.getCommandRect(len(items) > 1 && items[1] == "all"))
+	case "stretch":
+		if len(items) > 1 {
+			ratio, err := parseRatio(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			if ratio <= 0 {
+				m.SetError(fmt.Errorf("invalid stretch ratio: %s", items[1]))
+				return
+			}
+			policy := KeepFirst
+			wholePattern := false
+			for _, item := range items[2:] {
+				if item == "all" {
+					wholePattern = true
+				} else if p, ok := parseCollisionPolicy(item); ok {
+					policy = p
+				} else {
+					m.SetError(fmt.Errorf("invalid stretch option: %s", item))
+					return
+				}
+			}
+			if wholePattern {
+				m.StretchPattern(ratio, policy)
+			} else {
+				m.StretchSelection(ratio, policy)
+			}
+		}
+	case "velocity", "vel":
+		if len(items) > 1 {
+			velocity, err := parseInt(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			if velocity < 0 || velocity > 127 {
+				m.SetError(fmt.Errorf("invalid velocity: %d", velocity))
+				return
+			}
+			m.entryVelocity = velocity
+		}
+	case "step":
+		if len(items) > 1 {
+			step, err := parseInt(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			if step < 0 {
+				m.SetError(fmt.Errorf("invalid edit step: %d", step))
+				return
+			}
+			m.editStep = step
+		}
+	case "octave", "oct":
+		if len(items) > 1 {
+			octave, err := parseInt(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			if m.song.Root+octave*12 < 0 || m.song.Root+octave*12 > 127 {
+				m.SetError(fmt.Errorf("invalid octave: %d", octave))
+				return
+			}
+			m.noteOctave = octave
+		}
+	case "chord":
+		if len(items) > 1 {
+			if items[1] == "off" {
+				m.chordMode = false
+				return
+			}
+			chord, err := parseChord(items[1])
+			if err != nil {
+				m.SetError(err)
+				return
+			}
+			m.chord = chord
+			m.chordMode = true
 		}
 	case "root":
 		if len(items) > 1 {
@@ -125,6 +661,7 @@ func (m *Model) ExecuteCommand(command string) {
 				func() {
 					m.ReplaceEditPattern(p)
 				},
+				0,
 			)
 		}
 	case "tracks":
@@ -143,13 +680,16 @@ func (m *Model) ExecuteCommand(command string) {
 				return
 			}
 			clone := p.withNumTracks(numTracks)
+			states := m.allocTrackStates(clone.NumTracks)
 			m.submitAction(
 				func() {
+					m.useTrackStates(states)
 					m.ReplaceEditPattern(clone)
 				},
 				func() {
 					m.ReplaceEditPattern(p)
 				},
+				0,
 			)
 		}
 	}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type ConditionKind byte
+
+const (
+	CondNone ConditionKind = iota
+	CondProbability
+	CondLoop
+	CondFirst
+	CondNotFirst
+	CondPrev
+	CondNotPrev
+)
+
+type Condition struct {
+	Kind ConditionKind
+	A    int // probability in percent or N of N:M
+	B    int // M of N:M
+}
+
+func (c Condition) String() string {
+	switch c.Kind {
+	case CondProbability:
+		return fmt.Sprintf("%d%%", c.A)
+	case CondLoop:
+		return fmt.Sprintf("%d:%d", c.A, c.B)
+	case CondFirst:
+		return "first"
+	case CondNotFirst:
+		return "!first"
+	case CondPrev:
+		return "pre"
+	case CondNotPrev:
+		return "!pre"
+	}
+	return ""
+}
+
+func parseCondition(s string) (Condition, error) {
+	switch s {
+	case "", "-":
+		return Condition{}, nil
+	case "first", "1st":
+		return Condition{Kind: CondFirst}, nil
+	case "!first", "!1st":
+		return Condition{Kind: CondNotFirst}, nil
+	case "pre":
+		return Condition{Kind: CondPrev}, nil
+	case "!pre":
+		return Condition{Kind: CondNotPrev}, nil
+	}
+	if percent, ok := strings.CutSuffix(s, "%"); ok {
+		prob, err := strconv.Atoi(percent)
+		if err != nil || prob < 0 || prob > 100 {
+			return Condition{}, fmt.Errorf("invalid probability: %s", s)
+		}
+		return Condition{Kind: CondProbability, A: prob}, nil
+	}
+	if ns, ms, ok := strings.Cut(s, ":"); ok {
+		n, err1 := strconv.Atoi(ns)
+		m, err2 := strconv.Atoi(ms)
+		if err1 != nil || err2 != nil || n < 1 || m < n {
+			return Condition{}, fmt.Errorf("invalid loop condition: %s", s)
+		}
+		return Condition{Kind: CondLoop, A: n, B: m}, nil
+	}
+	return Condition{}, fmt.Errorf("invalid condition: %s", s)
+}
+
+func (c Condition) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Condition) UnmarshalText(text []byte) error {
+	cond, err := parseCondition(string(text))
+	if err != nil {
+		return err
+	}
+	*c = cond
+	return nil
+}
+
+func (m *Model) evalCondition(c Condition, ts *TrackState) bool {
+	var result bool
+	switch c.Kind {
+	case CondNone:
+		return true
+	case CondProbability:
+		result = m.rng.Intn(100) < c.A
+	case CondLoop:
+		result = ts.loop%c.B == c.A-1
+	case CondFirst:
+		result = ts.loop == 0
+	case CondNotFirst:
+		result = ts.loop > 0
+	case CondPrev:
+		return ts.condFired
+	case CondNotPrev:
+		return !ts.condFired
+	}
+	ts.condFired = result
+	return result
+}
+
+func (m *Model) SetCondition(cond Condition) {
+	p := m.song.Patterns[m.editPattern]
+	clone := p.clone()
+	firstTrack, lastTrack := m.selectedTracks()
+	for y := m.sel.Y; y < m.sel.Y+m.sel.H; y++ {
+		for t := firstTrack; t <= lastTrack; t++ {
+			clone.Attrs[y][t].Cond = cond
+		}
+	}
+	m.submitAction(
+		func() {
+			m.ReplaceEditPattern(clone)
+		},
+		func() {
+			m.ReplaceEditPattern(p)
+		},
+		0,
+	)
+}
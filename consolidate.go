@@ -0,0 +1,69 @@
+package main
+
+// getCommandRect returns the selection or the whole pattern when all is set
+func (m *Model) getCommandRect(all bool) Rect {
+	if all {
+		p := m.song.Patterns[m.editPattern]
+		return Rect{0, 0, p.Width(), p.Height()}
+	}
+	return m.sel
+}
+
+// Consolidate makes the status, note and velocity of every event inside
+// r explicit, resolved from the preceding rows like playback does
+func (m *Model) Consolidate(r Rect) {
+	firstTrack, lastTrack := r.X/6, (r.X+r.W-1)/6
+	m.replaceEditPatternWith(func(p, clone *Pattern) {
+		for t := firstTrack; t <= lastTrack; t++ {
+			defaults := p.TrackDefaults[t]
+			for y := range min(p.NumRows, r.Y+r.H) {
+				msg := p.Rows[y][t]
+				if y >= r.Y {
+					clone.Rows[y][t] = applyTrackDefaults(msg, defaults)
+				}
+				defaults = nextTrackDefaults(msg, defaults)
+			}
+		}
+	})
+}
+
+// Minimize strips the status and velocity of the events inside r when
+// they resolve to the same values from the preceding event anyway
+//
+// The first event of a track and events which follow a conditional one
+// are kept as they are because the values they would inherit depend on
+// the song or on the outcome of the condition.
+func (m *Model) Minimize(r Rect) {
+	firstTrack, lastTrack := r.X/6, (r.X+r.W-1)/6
+	m.replaceEditPatternWith(func(p, clone *Pattern) {
+		for t := firstTrack; t <= lastTrack; t++ {
+			defaults := p.TrackDefaults[t]
+			inherited := false
+			for y := range min(p.NumRows, r.Y+r.H) {
+				msg := p.Rows[y][t]
+				resolved := applyTrackDefaults(msg, defaults)
+				if resolved[0] < 0x80 || resolved[0] >= 0xF0 {
+					continue
+				}
+				if y >= r.Y && inherited {
+					clone.Rows[y][t] = minimizeMessage(resolved, defaults)
+				}
+				inherited = p.Attrs[y][t].Cond.Kind == CondNone
+				defaults = resolved
+			}
+		}
+	})
+}
+
+func minimizeMessage(msg, defaults MidiMessage) MidiMessage {
+	candidates := []MidiMessage{
+		{0, msg[1], 0},
+		{0, msg[1], msg[2]},
+	}
+	for _, c := range candidates {
+		if c != (MidiMessage{}) && applyTrackDefaults(c, defaults) == msg {
+			return c
+		}
+	}
+	return msg
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// getCellStatus returns the status byte a cell is played with, or would
+// be played with once it gets data bytes
+func (p *Pattern) getCellStatus(y, t int) byte {
+	defaults := p.TrackDefaults[t]
+	for row := range y {
+		defaults = nextTrackDefaults(p.Rows[row][t], defaults)
+	}
+	if status := p.Rows[y][t][0]; status != 0 {
+		return status
+	}
+	return defaults[0]
+}
+
+// cellLength returns the number of meaningful bytes of a cell played
+// with the given status
+func cellLength(status byte) int {
+	msg := MidiMessage{status}
+	if length := msg.length(); length > 0 {
+		return length
+	}
+	return 3
+}
+
+// cellStatusCache holds the statuses of the cursor row, cursor moves
+// reuse them until the row or the pattern changes
+//
+// Only the UI thread uses it: actions never move the cursor with
+// smartMove, edits invalidate it when they come back to Update.
+type cellStatusCache struct {
+	pattern   *Pattern
+	row       int
+	inherited []byte // status each track inherits from the rows above
+	statuses  []byte
+}
+
+// getRowStatuses returns getCellStatus for every track of the cursor row
+func (m *Model) getRowStatuses() []byte {
+	p := m.song.Patterns[m.editPattern]
+	y := m.editPos.Y
+	c := &m.cellStatuses
+	if c.pattern == p && c.row == y {
+		return c.statuses
+	}
+	defaults := slices.Clone(p.TrackDefaults)
+	for row := range y {
+		for t := range p.NumTracks {
+			defaults[t] = nextTrackDefaults(p.Rows[row][t], defaults[t])
+		}
+	}
+	c.inherited = c.inherited[:0]
+	c.statuses = c.statuses[:0]
+	for t := range p.NumTracks {
+		c.inherited = append(c.inherited, defaults[t][0])
+		status := p.Rows[y][t][0]
+		if status == 0 {
+			status = defaults[t][0]
+		}
+		c.statuses = append(c.statuses, status)
+	}
+	c.pattern = p
+	c.row = y
+	return c.statuses
+}
+
+// updateCellStatus records the new message of a cell in the cursor row
+// whose edit has not reached the pattern yet
+func (m *Model) updateCellStatus(t int, msg MidiMessage) {
+	m.getRowStatuses()
+	c := &m.cellStatuses
+	if status := msg[0]; status != 0 {
+		c.statuses[t] = status
+	} else {
+		c.statuses[t] = c.inherited[t]
+	}
+}
+
+func (m *Model) invalidateCellStatuses() {
+	m.cellStatuses.pattern = nil
+}
+
+func (m *Model) ToggleSmartCursor() {
+	m.smartCursor = !m.smartCursor
+	m.noteField = 1
+}
+
+// smartMove moves the cursor by dx nibbles skipping those which are
+// meaningless for the message of their cell
+func (m *Model) smartMove(dx int) {
+	p := m.song.Patterns[m.editPattern]
+	statuses := m.getRowStatuses()
+	for x := m.editPos.X + dx; x >= 0 && x < p.Width(); x += dx {
+		if x%6 < cellLength(statuses[x/6])*2 {
+			m.moveBrush(x-m.editPos.X, 0)
+			return
+		}
+	}
+}
+
+func (m *Model) NextNoteField() {
+	p := m.song.Patterns[m.editPattern]
+	t := m.CurrentTrack()
+	if m.noteField+1 < cellLength(m.getRowStatuses()[t]) {
+		m.noteField++
+	} else if t+1 < p.NumTracks {
+		m.NextTrack()
+		m.noteField = 0
+	}
+}
+
+func (m *Model) PrevNoteField() {
+	t := m.CurrentTrack()
+	if m.noteField > 0 {
+		m.noteField--
+	} else if t > 0 {
+		m.PrevTrack()
+		m.noteField = cellLength(m.getRowStatuses()[t-1]) - 1
+	}
+}
+
+// EnterDecimalMode opens the inline decimal editor on the byte of the
+// cell at (x, y) which contains nibble x
+func (m *Model) EnterDecimalMode(x, y int, input string) {
+	m.decimalPos = Point{x - x%2, y}
+	m.decimalInput = input
+	m.EnterMode(DecimalMode)
+}
+
+func (m *Model) decimalInputLimit() int {
+	p := m.song.Patterns[m.editPattern]
+	pos := m.decimalPos
+	if p.getCellStatus(pos.Y, pos.X/6) >= 0xF0 {
+		return 5
+	}
+	return 3
+}
+
+func (m *Model) AppendDecimalDigit(digit rune) {
+	if len(m.decimalInput) < m.decimalInputLimit() {
+		m.decimalInput += string(digit)
+	}
+}
+
+func (m *Model) BackspaceDecimalDigit() {
+	if n := len(m.decimalInput); n > 0 {
+		m.decimalInput = m.decimalInput[:n-1]
+	}
+}
+
+// CommitDecimalInput writes the value typed into the decimal editor:
+// a channel (1-16) for the status byte, 0-127 for data bytes and a 14
+// bit value for the data bytes of tempo commands
+func (m *Model) CommitDecimalInput() {
+	defer m.LeaveMode()
+	if m.decimalInput == "" {
+		return
+	}
+	value, err := strconv.Atoi(m.decimalInput)
+	if err != nil {
+		m.SetError(err)
+		return
+	}
+	p := m.song.Patterns[m.editPattern]
+	pos := m.decimalPos
+	t := pos.X / 6
+	prevMsg := p.Rows[pos.Y][t]
+	msg := prevMsg
+	status := p.getCellStatus(pos.Y, t)
+	switch i := pos.X % 6 / 2; {
+	case i == 0:
+		if value < 1 || value > 16 || status < 0x80 || status >= 0xF0 {
+			m.SetError(fmt.Errorf("invalid channel: %d", value))
+			return
+		}
+		msg[0] = status&0xf0 | byte(value-1)
+	case status >= 0xF0:
+		if value > maxCommandValue {
+			m.SetError(fmt.Errorf("invalid value: %d", value))
+			return
+		}
+		setCommandValue(&msg, value)
+	default:
+		if value > 127 {
+			m.SetError(fmt.Errorf("invalid value: %d", value))
+			return
+		}
+		msg[i] = byte(value)
+	}
+	m.submitAction(
+		func() {
+			m.song.Patterns[m.editPattern].Rows[pos.Y][t] = msg
+		},
+		func() {
+			m.song.Patterns[m.editPattern].Rows[pos.Y][t] = prevMsg
+		},
+		0,
+	)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type DisplayMode int
+
+const (
+	DisplayHex DisplayMode = iota
+	DisplayReadable
+)
+
+func (m *Model) ToggleDisplayMode() {
+	if m.displayMode == DisplayHex {
+		m.displayMode = DisplayReadable
+	} else {
+		m.displayMode = DisplayHex
+	}
+}
+
+func formatByteHex(b byte) string {
+	if b == 0 {
+		return "··"
+	}
+	return fmt.Sprintf("%02X", b)
+}
+
+func formatCellHex(msg MidiMessage) []rune {
+	return []rune(formatByteHex(msg[0]) + formatByteHex(msg[1]) + formatByteHex(msg[2]))
+}
+
+// getGhostMask tells which characters of a formatted cell show values
+// inherited from the track defaults
+func getGhostMask(msg, ghost MidiMessage, readable bool) (mask [6]bool) {
+	for i := range 3 {
+		if msg[i] != 0 || ghost[i] == 0 {
+			continue
+		}
+		if !readable {
+			mask[i*2] = true
+			mask[i*2+1] = true
+		} else if kind := ghost[0] >> 4; i == 2 && (kind == 0x9 || kind == 0xA) {
+			mask[4] = true
+			mask[5] = true
+		}
+	}
+	return mask
+}
+
+// formatCellNote formats a note in three characters, the octave is
+// written as a hex digit so that notes above B-9 also fit
+func formatCellNote(note byte) string {
+	return formatNote(int(note))[:2] + hexDigits[note/12:note/12+1]
+}
+
+// formatCell decodes a message into six characters, status is the
+// status byte the message is played with
+func formatCell(msg MidiMessage, status byte) []rune {
+	if msg == (MidiMessage{}) {
+		return formatCellHex(msg)
+	}
+	var s string
+	kind := status >> 4
+	if (kind == 0x8 || kind == 0x9 || kind == 0xA) && msg[1] > 0x7f {
+		return formatCellHex(msg)
+	}
+	switch kind {
+	case 0x8:
+		s = formatCellNote(msg[1]) + " =="
+	case 0x9:
+		s = formatCellNote(msg[1]) + " " + formatByteHex(msg[2])
+	case 0xA:
+		s = formatCellNote(msg[1]) + "^" + formatByteHex(msg[2])
+	case 0xB:
+		s = fmt.Sprintf("c%02X=%02X", msg[1], msg[2])
+	case 0xC:
+		s = fmt.Sprintf("PC %02X", msg[1])
+	case 0xD:
+		s = fmt.Sprintf("AT %02X", msg[1])
+	case 0xE:
+		value := int(msg[1]&0x7f) | int(msg[2]&0x7f)<<7
+		s = fmt.Sprintf("p%+05d", value-pitchWheelCenter)
+	case 0xF:
+		value := commandValue(msg)
+		switch status {
+		case CmdSetBPM:
+			s = fmt.Sprintf("T%5d", value)
+		case CmdSetLPB:
+			s = fmt.Sprintf("L%5d", value)
+		case CmdSetTPL:
+			s = fmt.Sprintf("S%5d", value)
+		}
+	}
+	text := []rune(s)
+	if len(text) == 0 || len(text) > 6 {
+		return formatCellHex(msg)
+	}
+	return []rune(s + strings.Repeat(" ", 6-len(text)))
+}
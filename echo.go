@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+type scheduledMessage struct {
+	tick  int // value of tickCount when the message is due
+	track int // track which plays the message or -1 to send it as is
+	msg   MidiMessage
+}
+
+func (m *Model) scheduleTrackMessage(delay int, numTrack int, msg MidiMessage) {
+	tick := m.tickCount + delay
+	i, _ := slices.BinarySearchFunc(m.scheduled, tick+1, func(s scheduledMessage, tick int) int {
+		return s.tick - tick
+	})
+	m.scheduled = slices.Insert(m.scheduled, i, scheduledMessage{tick, numTrack, msg})
+}
+
+func (m *Model) scheduleMessage(delay int, msg MidiMessage) {
+	m.scheduleTrackMessage(delay, -1, msg)
+}
+
+// cancelNoteOff drops the pending note-off of a note which is started
+// again so that it does not cut the new note short
+func (m *Model) cancelNoteOff(numTrack int, msg MidiMessage) {
+	m.scheduled = slices.DeleteFunc(m.scheduled, func(s scheduledMessage) bool {
+		return s.track == numTrack && s.msg[0] == 0x80|msg[0]&0x0f && s.msg[1] == msg[1]
+	})
+}
+
+// releaseScheduledNoteOffs sends the note-offs still waiting in the
+// queue and drops everything else so that no note is left hanging
+func (m *Model) releaseScheduledNoteOffs() {
+	for _, s := range m.scheduled {
+		kind := s.msg[0] >> 4
+		if kind == 0x8 || kind == 0x9 && s.msg[2] == 0 {
+			m.releaseMessages = append(m.releaseMessages, s.msg)
+		}
+	}
+	m.scheduled = m.scheduled[:0]
+}
+
+func (m *Model) processScheduledMessages(p *Pattern, emit func(MidiMessage)) {
+	n := 0
+	for n < len(m.scheduled) && m.scheduled[n].tick <= m.tickCount {
+		s := m.scheduled[n]
+		if s.track >= 0 && s.track < p.NumTracks {
+			m.playTrackMessage(p, s.track, s.msg, emit)
+		} else if s.track < 0 {
+			emit(s.msg)
+		}
+		n++
+	}
+	m.scheduled = slices.Delete(m.scheduled, 0, n)
+}
+
+func (s *TrackSettings) getEchoFeedback() int {
+	if s.EchoFeedback > 0 {
+		return s.EchoFeedback
+	}
+	return 50
+}
+
+// echoMessage returns the nth repeat of a note message or false if the
+// repeat falls outside the MIDI note range
+func (s *TrackSettings) echoMessage(msg MidiMessage, n int) (MidiMessage, bool) {
+	note := int(msg[1]) + n*s.EchoTranspose
+	if note < 0 || note > 127 {
+		return msg, false
+	}
+	msg[1] = byte(note)
+	if msg[0]>>4 == 0x9 && msg[2] != 0 {
+		velocity := float64(msg[2])
+		for range n {
+			velocity = velocity * float64(s.getEchoFeedback()) / 100
+		}
+		msg[2] = byte(max(1, min(int(velocity+0.5), 127)))
+	}
+	return msg, true
+}
+
+// scheduleEcho schedules the repeats of a note-on or note-off message,
+// note-offs are repeated like note-ons so that every echo is released
+func (m *Model) scheduleEcho(settings *TrackSettings, msg MidiMessage) {
+	if settings.EchoRepeats <= 0 || settings.EchoDelay <= 0 {
+		return
+	}
+	for n := 1; n <= settings.EchoRepeats; n++ {
+		if echo, ok := settings.echoMessage(msg, n); ok {
+			m.scheduleMessage(n*settings.EchoDelay, echo)
+		}
+	}
+}
+
+// BakeEcho writes the echoes of the selected tracks into free cells of
+// the selection and turns off their echo effect
+func (m *Model) BakeEcho() {
+	firstTrack, lastTrack := m.selectedTracks()
+	dropped := 0
+	m.replaceEditPatternWith(func(p, clone *Pattern) {
+		for t := firstTrack; t <= lastTrack; t++ {
+			settings := p.TrackSettings[t]
+			if settings.EchoRepeats <= 0 || settings.EchoDelay <= 0 {
+				continue
+			}
+			tpl := settings.scaleTPL(m.song.TPL)
+			defaults := p.TrackDefaults[t]
+			for y := range p.NumRows {
+				msg := applyTrackDefaults(p.Rows[y][t], defaults)
+				defaults = nextTrackDefaults(p.Rows[y][t], defaults)
+				if p.Rows[y][t] == (MidiMessage{}) {
+					continue
+				}
+				if kind := msg[0] >> 4; kind != 0x8 && kind != 0x9 {
+					continue
+				}
+				attrs := p.Attrs[y][t]
+				for n := 1; n <= settings.EchoRepeats; n++ {
+					echo, ok := settings.echoMessage(msg, n)
+					if !ok {
+						continue
+					}
+					tick := attrs.Delay + n*settings.EchoDelay
+					echoY := y + tick/tpl
+					if echoY >= clone.NumRows {
+						dropped += settings.EchoRepeats - n + 1
+						break
+					}
+					placed := false
+					for i := range lastTrack - firstTrack + 1 {
+						u := firstTrack + (t-firstTrack+i)%(lastTrack-firstTrack+1)
+						if clone.Rows[echoY][u] == (MidiMessage{}) {
+							clone.Rows[echoY][u] = echo
+							clone.Attrs[echoY][u] = CellAttrs{
+								Delay:     tick % tpl,
+								GateRows:  attrs.GateRows,
+								GateTicks: attrs.GateTicks,
+							}
+							placed = true
+							break
+						}
+					}
+					if !placed {
+						dropped++
+					}
+				}
+			}
+			clone.TrackSettings[t].EchoRepeats = 0
+		}
+	})
+	if dropped > 0 {
+		m.SetError(fmt.Errorf("%d echoes did not fit into the selection", dropped))
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math"
+)
+
+const pitchWheelCenter = 0x2000
+
+func pitchWheelValue(semitones float64, bendRange int) int {
+	value := pitchWheelCenter + int(math.Round(semitones/float64(bendRange)*pitchWheelCenter))
+	return max(0, min(value, 0x3fff))
+}
+
+func centerPitchBend(channel byte) MidiMessage {
+	return MidiMessage{0xe0 | channel, pitchWheelCenter & 0x7f, pitchWheelCenter >> 7}
+}
+
+func (m *Model) updatePitch(settings *TrackSettings, ts *TrackState, emit func(MidiMessage)) {
+	if ts.note < 0 || !settings.hasPitchEffects() {
+		if ts.bend != pitchWheelCenter {
+			emit(centerPitchBend(ts.channel))
+			ts.bend = pitchWheelCenter
+		}
+		return
+	}
+	semitones := 0.0
+	if ts.glideTicks > 0 {
+		semitones += ts.glideFrom * float64(ts.glideTicks) / float64(ts.glideTotal)
+	}
+	if settings.VibratoSpeed > 0 && settings.VibratoDepth > 0 {
+		phase := float64(ts.vibratoTick) / float64(settings.VibratoSpeed)
+		semitones += float64(settings.VibratoDepth) / 100 * math.Sin(2*math.Pi*phase)
+	}
+	bend := pitchWheelValue(semitones, settings.GetBendRange())
+	if bend != ts.bend {
+		emit(MidiMessage{0xe0 | ts.channel, byte(bend & 0x7f), byte(bend >> 7)})
+		ts.bend = bend
+	}
+}
+
+func (m *Model) updateSlide(ts *TrackState, emit func(MidiMessage)) {
+	if ts.slideTicks == 0 {
+		return
+	}
+	ts.slideTick++
+	value := ts.slideFrom + (ts.slideTo-ts.slideFrom)*ts.slideTick/ts.slideTicks
+	if value != ts.cc[ts.slideCC] {
+		emit(MidiMessage{0xb0 | ts.slideCh, ts.slideCC, byte(value)})
+		ts.cc[ts.slideCC] = value
+	}
+	if ts.slideTick == ts.slideTicks {
+		ts.slideTicks = 0
+	}
+}
+
+func (m *Model) finishSlide(ts *TrackState, emit func(MidiMessage)) {
+	if ts.slideTicks == 0 {
+		return
+	}
+	ts.slideTick = ts.slideTicks - 1
+	m.updateSlide(ts, emit)
+}
+
+func (m *Model) playTrackMessage(p *Pattern, numTrack int, msg MidiMessage, emit func(MidiMessage)) {
+	settings := &p.TrackSettings[numTrack]
+	ts := m.getTrackState(numTrack)
+	channel := msg[0] & 0x0f
+	if kind := msg[0] >> 4; kind == 0x8 || kind == 0x9 {
+		if arpTrack := m.getArpTrack(p, numTrack); arpTrack >= 0 {
+			m.holdArpNote(m.getTrackState(arpTrack), numTrack, msg)
+			return
+		}
+	}
+	switch msg[0] >> 4 {
+	case 0x9:
+		if msg[2] == 0 {
+			if int(msg[1]) == ts.note {
+				ts.note = -1
+			}
+			break
+		}
+		m.cancelNoteOff(numTrack, msg)
+		if settings.Mono && ts.note >= 0 {
+			off := MidiMessage{0x80 | ts.channel, byte(ts.note), 0}
+			emit(off)
+			m.scheduleEcho(settings, off)
+		}
+		if settings.Glide > 0 && ts.note >= 0 {
+			ts.glideFrom = float64(ts.note - int(msg[1]))
+			ts.glideTicks = settings.Glide
+			ts.glideTotal = settings.Glide
+		} else {
+			ts.glideTicks = 0
+		}
+		ts.note = int(msg[1])
+		ts.channel = channel
+		m.updatePitch(settings, ts, emit)
+	case 0x8:
+		if int(msg[1]) == ts.note {
+			ts.note = -1
+		}
+	case 0xB:
+		m.finishSlide(ts, emit)
+		cc := msg[1] & 0x7f
+		from := ts.cc[cc]
+		to := int(msg[2] & 0x7f)
+		if settings.Slide > 0 && from >= 0 && from != to {
+			ts.slideCh = channel
+			ts.slideCC = cc
+			ts.slideFrom = from
+			ts.slideTo = to
+			ts.slideTick = 0
+			ts.slideTicks = settings.Slide
+			return
+		}
+		ts.cc[cc] = to
+	}
+	emit(msg)
+	if kind := msg[0] >> 4; kind == 0x8 || kind == 0x9 {
+		m.scheduleEcho(settings, msg)
+	}
+}
+
+// releasePitchBends centers the pitch wheel of the tracks which were
+// left bent when playback stopped
+func (m *Model) releasePitchBends() {
+	for i := range m.trackStates {
+		ts := &m.trackStates[i]
+		if ts.bend != pitchWheelCenter {
+			m.releaseMessages = append(m.releaseMessages, centerPitchBend(ts.channel))
+			ts.bend = pitchWheelCenter
+		}
+	}
+}
+
+func (m *Model) processTrackEffects(p *Pattern, emit func(MidiMessage)) {
+	for numTrack := range p.NumTracks {
+		settings := &p.TrackSettings[numTrack]
+		ts := m.getTrackState(numTrack)
+		m.updateSlide(ts, emit)
+		m.updateArp(p, numTrack, ts, emit)
+		m.updatePitch(settings, ts, emit)
+		if ts.glideTicks > 0 {
+			ts.glideTicks--
+		}
+		ts.vibratoTick++
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+func (m *Model) OctaveUp() {
+	if m.song.Root+(m.noteOctave+1)*12 <= 127 {
+		m.noteOctave++
+	}
+}
+
+func (m *Model) OctaveDown() {
+	if m.song.Root+(m.noteOctave-1)*12 >= 0 {
+		m.noteOctave--
+	}
+}
+
+func (m *Model) advanceEditStep() {
+	m.moveBrush(0, m.editStep)
+}
+
+// EnterNote writes a note (and the entry velocity when set) into the
+// current cell, plays it and advances the cursor by the edit step
+func (m *Model) EnterNote(midiNote int) {
+	p := m.song.Patterns[m.editPattern]
+	y := m.editPos.Y
+	t := m.CurrentTrack()
+	prevMsg := p.Rows[y][t]
+	msg := prevMsg
+	msg[1] = byte(midiNote)
+	if m.entryVelocity > 0 {
+		msg[2] = byte(m.entryVelocity)
+	}
+	m.submitAction(
+		func() {
+			m.song.Patterns[m.editPattern].Rows[y][t] = msg
+		},
+		func() {
+			m.song.Patterns[m.editPattern].Rows[y][t] = prevMsg
+		},
+		0,
+	)
+	m.previewNote(t, msg[1], msg[2])
+	m.advanceEditStep()
+}
+
+// EnterNoteOff writes a note-off for the last note above the cursor on
+// the channel the track is playing on
+func (m *Model) EnterNoteOff() {
+	p := m.song.Patterns[m.editPattern]
+	y := m.editPos.Y
+	t := m.CurrentTrack()
+	var note byte
+	status := p.TrackDefaults[t][0]
+	for row := range y {
+		msg := p.Rows[row][t]
+		if msg[0] != 0 {
+			status = msg[0]
+		}
+		if status>>4 == 0x9 && msg[1] != 0 {
+			note = msg[1]
+		}
+	}
+	prevMsg := p.Rows[y][t]
+	msg := MidiMessage{0x80 | p.resolveStatus(y, t)&0x0f, note, 0}
+	m.submitAction(
+		func() {
+			m.song.Patterns[m.editPattern].Rows[y][t] = msg
+		},
+		func() {
+			m.song.Patterns[m.editPattern].Rows[y][t] = prevMsg
+		},
+		0,
+	)
+	m.pendingMidiMessages <- msg
+	m.advanceEditStep()
+}
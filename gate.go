@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func (a CellAttrs) hasGate() bool {
+	return a.GateRows > 0 || a.GateTicks > 0
+}
+
+// parseGate parses a gate length given as rows, rows+ticks or +ticks
+func parseGate(s string) (rows, ticks int, err error) {
+	rowsString, ticksString, hasTicks := strings.Cut(s, "+")
+	if rowsString != "" {
+		if rows, err = parseInt(rowsString); err != nil || rows < 0 {
+			return 0, 0, fmt.Errorf("invalid gate: %s", s)
+		}
+	}
+	if hasTicks {
+		if ticks, err = parseInt(ticksString); err != nil || ticks < 0 {
+			return 0, 0, fmt.Errorf("invalid gate: %s", s)
+		}
+	}
+	return rows, ticks, nil
+}
+
+func (m *Model) SetGate(rows, ticks int) {
+	sel := m.sel
+	firstTrack, lastTrack := m.selectedTracks()
+	m.replaceEditPatternWith(func(p, clone *Pattern) {
+		for y := sel.Y; y < sel.Y+sel.H; y++ {
+			for t := firstTrack; t <= lastTrack; t++ {
+				clone.Attrs[y][t].GateRows = rows
+				clone.Attrs[y][t].GateTicks = ticks
+			}
+		}
+	})
+}
+
+// scheduleNoteOff queues the note-off which ends a gated note
+func (m *Model) scheduleNoteOff(p *Pattern, numTrack int, msg MidiMessage, attrs CellAttrs) {
+	gate := attrs.GateRows*m.GetTrackTPL(p, numTrack) + attrs.GateTicks
+	m.scheduleTrackMessage(max(1, gate), numTrack, MidiMessage{0x80 | msg[0]&0x0f, msg[1], 0})
+}
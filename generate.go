@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+type Waveform int
+
+const (
+	WaveSine Waveform = iota
+	WaveTriangle
+	WaveSaw
+	WaveSquare
+	WaveRandom
+)
+
+func parseWaveform(s string) (Waveform, error) {
+	switch s {
+	case "sine", "sin":
+		return WaveSine, nil
+	case "triangle", "tri":
+		return WaveTriangle, nil
+	case "saw":
+		return WaveSaw, nil
+	case "square", "sq":
+		return WaveSquare, nil
+	case "random", "rand", "sh":
+		return WaveRandom, nil
+	}
+	return WaveSine, fmt.Errorf("invalid waveform: %s", s)
+}
+
+// value returns the waveform at phase (0..1) scaled to 0..1
+func (w Waveform) value(phase float64) float64 {
+	switch w {
+	case WaveTriangle:
+		if phase < 0.5 {
+			return 2 * phase
+		}
+		return 2 - 2*phase
+	case WaveSaw:
+		return phase
+	case WaveSquare:
+		if phase < 0.5 {
+			return 1
+		}
+		return 0
+	}
+	return 0.5 + 0.5*math.Sin(2*math.Pi*phase)
+}
+
+// parsePeriod parses a length given in rows or in beats (with a b suffix)
+func (m *Model) parsePeriod(s string) (float64, error) {
+	rows, inBeats := strings.CutSuffix(s, "b")
+	period, err := strconv.ParseFloat(rows, 64)
+	if err != nil {
+		return 0, err
+	}
+	if inBeats {
+		period *= float64(m.song.LPB)
+	}
+	if period <= 0 {
+		return 0, fmt.Errorf("invalid period: %s", s)
+	}
+	return period, nil
+}
+
+type LFO struct {
+	Wave   Waveform
+	CC     int // controller number or -1 for pitch wheel
+	Period float64
+	Min    int
+	Max    int
+	Phase  float64
+}
+
+func (m *Model) parseLFO(args []string) (lfo LFO, err error) {
+	if len(args) < 2 {
+		return lfo, fmt.Errorf("usage: lfo <wave> <ccN|pb> [period [min [max [phase]]]]")
+	}
+	if lfo.Wave, err = parseWaveform(args[0]); err != nil {
+		return lfo, err
+	}
+	lfo.Max = 127
+	switch target := args[1]; {
+	case target == "pb":
+		lfo.CC = -1
+		lfo.Max = 0x3fff
+	case strings.HasPrefix(target, "cc"):
+		if lfo.CC, err = parseInt(target[2:]); err != nil || lfo.CC < 0 || lfo.CC > 127 {
+			return lfo, fmt.Errorf("invalid controller: %s", target)
+		}
+	default:
+		return lfo, fmt.Errorf("invalid LFO target: %s", target)
+	}
+	lfo.Period = float64(m.song.LPB * 4)
+	if len(args) > 2 {
+		if lfo.Period, err = m.parsePeriod(args[2]); err != nil {
+			return lfo, err
+		}
+	}
+	limit := lfo.Max
+	if len(args) > 3 {
+		if lfo.Min, err = parseInt(args[3]); err != nil {
+			return lfo, err
+		}
+	}
+	if len(args) > 4 {
+		if lfo.Max, err = parseInt(args[4]); err != nil {
+			return lfo, err
+		}
+	}
+	if lfo.Min < 0 || lfo.Max > limit || lfo.Min > limit || lfo.Max < 0 {
+		return lfo, fmt.Errorf("LFO range out of bounds: %d..%d", lfo.Min, lfo.Max)
+	}
+	if len(args) > 5 {
+		if lfo.Phase, err = strconv.ParseFloat(args[5], 64); err != nil {
+			return lfo, err
+		}
+	}
+	return lfo, nil
+}
+
+func (m *Model) GenerateLFO(lfo LFO) {
+	sel := m.sel
+	firstTrack, lastTrack := m.selectedTracks()
+	seed := m.song.Seed
+	m.replaceEditPatternWith(func(p, clone *Pattern) {
+		for t := firstTrack; t <= lastTrack; t++ {
+			rng := rand.New(rand.NewSource(seed))
+			channel := p.resolveStatus(sel.Y, t) & 0x0f
+			cycle := -1
+			held := 0.0
+			for y := sel.Y; y < sel.Y+sel.H; y++ {
+				pos := float64(y-sel.Y)/lfo.Period + lfo.Phase
+				phase := pos - math.Floor(pos)
+				f := lfo.Wave.value(phase)
+				if lfo.Wave == WaveRandom {
+					if c := int(math.Floor(pos)); c != cycle {
+						cycle = c
+						held = rng.Float64()
+					}
+					f = held
+				}
+				value := lerp(lfo.Min, lfo.Max, f)
+				clone.Attrs[y][t] = CellAttrs{}
+				if lfo.CC < 0 {
+					clone.Rows[y][t] = MidiMessage{0xe0 | channel, byte(value & 0x7f), byte(value >> 7)}
+				} else {
+					clone.Rows[y][t] = MidiMessage{0xb0 | channel, byte(lfo.CC), byte(value)}
+				}
+			}
+		}
+	})
+}
+
+func euclid(k, n, rotate int) []bool {
+	steps := make([]bool, n)
+	for i := range n {
+		_, j := floorDivMod(i+rotate, n)
+		steps[i] = j*k%n < k
+	}
+	return steps
+}
+
+func parseSteps(s string) ([]bool, error) {
+	steps := make([]bool, 0, len(s))
+	for _, c := range s {
+		switch c {
+		case 'x', 'X':
+			steps = append(steps, true)
+		case '.', '-':
+			steps = append(steps, false)
+		default:
+			return nil, fmt.Errorf("invalid step: %c", c)
+		}
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("no steps")
+	}
+	return steps, nil
+}
+
+func (m *Model) getEntryNote(p *Pattern, y, t int) MidiMessage {
+	msg := p.Rows[y][t]
+	defaults := p.TrackDefaults[t]
+	channel := p.resolveStatus(y, t) & 0x0f
+	note := MidiMessage{0x90 | channel, msg[1], msg[2]}
+	if note[1] == 0 {
+		note[1] = defaults[1]
+	}
+	if note[1] == 0 {
+		note[1] = byte(m.song.Root)
+	}
+	if note[2] == 0 {
+		note[2] = defaults[2]
+	}
+	if note[2] == 0 {
+		note[2] = 0x70
+	}
+	return note
+}
+
+func (m *Model) GenerateSteps(steps []bool) {
+	sel := m.sel
+	editPos := m.editPos
+	firstTrack, lastTrack := m.selectedTracks()
+	m.replaceEditPatternWith(func(p, clone *Pattern) {
+		for t := firstTrack; t <= lastTrack; t++ {
+			note := m.getEntryNote(p, editPos.Y, t)
+			for y := sel.Y; y < sel.Y+sel.H; y++ {
+				clone.Attrs[y][t] = CellAttrs{}
+				if steps[(y-sel.Y)%len(steps)] {
+					clone.Rows[y][t] = note
+				} else {
+					clone.Rows[y][t] = MidiMessage{}
+				}
+			}
+		}
+	})
+}
+
+type MelodyParams struct {
+	Low     int // lowest scale degree
+	Range   int // in scale degrees
+	Density int // percent of grid steps with a note
+	Leap    int // maximum interval between consecutive notes in degrees
+	Grid    int // rows per step
+	Seed    int64
+}
+
+func (m *Model) parseMelodyParams(args []string) (params MelodyParams, err error) {
+	params = MelodyParams{
+		Range:   7,
+		Density: 50,
+		Leap:    2,
+		Grid:    1,
+		Seed:    m.song.Seed,
+	}
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return params, fmt.Errorf("invalid melody parameter: %s", arg)
+		}
+		n, err := parseInt(value)
+		if err != nil {
+			return params, err
+		}
+		switch name {
+		case "low":
+			params.Low = n
+		case "range":
+			params.Range = n
+		case "density":
+			params.Density = n
+		case "leap":
+			params.Leap = n
+		case "grid":
+			params.Grid = n
+		case "seed":
+			params.Seed = int64(n)
+		default:
+			return params, fmt.Errorf("unknown melody parameter: %s", name)
+		}
+	}
+	if params.Range < 0 || params.Density < 0 || params.Density > 100 || params.Leap < 1 || params.Grid < 1 {
+		return params, fmt.Errorf("invalid melody parameters")
+	}
+	return params, nil
+}
+
+func (m *Model) GenerateMelody(params MelodyParams) {
+	sel := m.sel
+	editPos := m.editPos
+	firstTrack, lastTrack := m.selectedTracks()
+	m.replaceEditPatternWith(func(p, clone *Pattern) {
+		rng := rand.New(rand.NewSource(params.Seed))
+		for t := firstTrack; t <= lastTrack; t++ {
+			note := m.getEntryNote(p, editPos.Y, t)
+			degree := params.Low + rng.Intn(params.Range+1)
+			for y := sel.Y; y < sel.Y+sel.H; y++ {
+				clone.Rows[y][t] = MidiMessage{}
+				clone.Attrs[y][t] = CellAttrs{}
+				if (y-sel.Y)%params.Grid != 0 || rng.Intn(100) >= params.Density {
+					continue
+				}
+				degree += rng.Intn(2*params.Leap+1) - params.Leap
+				degree = max(params.Low, min(degree, params.Low+params.Range))
+				note[1] = byte(m.DegreeToMidiNote(degree))
+				clone.Rows[y][t] = note
+			}
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type Groove struct {
+	Offsets    []int `json:"offsets"`    // per-line delay in ticks
+	Velocities []int `json:"velocities"` // per-line velocity scale in percent
+}
+
+func LoadGroove(filename string) (*Groove, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	groove := &Groove{}
+	if err := json.Unmarshal(b, groove); err != nil {
+		return nil, err
+	}
+	if len(groove.Offsets) == 0 && len(groove.Velocities) == 0 {
+		return nil, fmt.Errorf("empty groove: %s", filename)
+	}
+	return groove, nil
+}
+
+func (m *Model) GetSwing(p *Pattern) int {
+	if p.Swing != nil {
+		return *p.Swing
+	}
+	return m.song.Swing
+}
+
+func (m *Model) GetRowDelay(p *Pattern, y int, tpl int) int {
+	delay := 0
+	if y%2 == 1 {
+		delay += (m.GetSwing(p)*tpl + 50) / 100
+	}
+	if g := m.song.Groove; g != nil && len(g.Offsets) > 0 {
+		delay += g.Offsets[y%len(g.Offsets)]
+	}
+	return max(0, min(delay, tpl-1))
+}
+
+func (m *Model) GetRowVelocityScale(y int) int {
+	if g := m.song.Groove; g != nil && len(g.Velocities) > 0 {
+		return g.Velocities[y%len(g.Velocities)]
+	}
+	return 100
+}
+
+func scaleVelocity(msg MidiMessage, scale int) MidiMessage {
+	if msg[0]>>4 == 0x9 && msg[2] != 0 && scale != 100 {
+		msg[2] = byte(max(1, min(int(msg[2])*scale/100, 127)))
+	}
+	return msg
+}
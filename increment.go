@@ -0,0 +1,99 @@
+package main
+
+import (
+	"time"
+)
+
+// key repeats closer than this are undone together
+const incrementBurstTimeout = 500 * time.Millisecond
+
+type incrementBurst struct {
+	id        int
+	sel       Rect
+	byteIndex int
+	pattern   int
+	original  *Pattern // pattern before the first step, nil if no burst is going on
+	last      time.Time
+}
+
+func clampInt(value, low, high int) int {
+	return max(low, min(value, high))
+}
+
+// stepStatus changes the channel by 1 or the message kind by 16
+func stepStatus(status byte, amount int) byte {
+	if amount%16 == 0 {
+		kind := clampInt(int(status>>4)+amount/16, 0x8, 0xE)
+		return byte(kind<<4) | status&0x0f
+	}
+	channel := clampInt(int(status&0x0f)+amount, 0, 15)
+	return status&0xf0 | byte(channel)
+}
+
+// incrementRows adds amount to byte byteIndex of the events in rows
+// y0..y1-1 and tracks t0..t1 of p, writing the results into clone
+func incrementRows(p, clone *Pattern, y0, y1, t0, t1, byteIndex, amount int) {
+	for t := t0; t <= t1; t++ {
+		defaults := p.TrackDefaults[t]
+		for y := range y1 {
+			msg := p.Rows[y][t]
+			resolved := applyTrackDefaults(msg, defaults)
+			defaults = nextTrackDefaults(msg, defaults)
+			if y < y0 || msg == (MidiMessage{}) {
+				continue
+			}
+			status := resolved[0]
+			target := &clone.Rows[y][t]
+			switch {
+			case status < 0x80:
+			case byteIndex == 0:
+				if msg[0] != 0 && status < 0xF0 {
+					target[0] = stepStatus(status, amount)
+				}
+			case status >= 0xF0:
+				value := clampInt(commandValue(resolved)+amount, 1, maxCommandValue)
+				setCommandValue(target, value)
+			case byteIndex >= resolved.length():
+			default:
+				target[byteIndex] = byte(clampInt(int(resolved[byteIndex])+amount, 0, 127))
+			}
+		}
+	}
+}
+
+// IncrementSelection adds amount to the byte under the cursor in every
+// event of the selection, keeping values inside their MIDI range
+//
+// Each step is computed on the audio thread from the pattern as left
+// by the previous step, so fast key repeats do not lose steps.
+func (m *Model) IncrementSelection(amount int) {
+	b := &m.incrementBurst
+	sel := m.sel
+	byteIndex := m.editPos.X % 6 / 2
+	now := time.Now()
+	if b.original == nil || b.sel != sel || b.byteIndex != byteIndex || b.pattern != m.editPattern || now.Sub(b.last) > incrementBurstTimeout {
+		b.id++
+		b.sel = sel
+		b.byteIndex = byteIndex
+		b.pattern = m.editPattern
+		b.original = m.song.Patterns[m.editPattern]
+	}
+	b.last = now
+	firstTrack, lastTrack := m.selectedTracks()
+	original := b.original
+	var result *Pattern // kept for redo
+	m.submitAction(
+		func() {
+			if result == nil {
+				p := m.song.Patterns[m.editPattern]
+				result = p.clone()
+				incrementRows(p, result, sel.Y, sel.Y+sel.H, firstTrack, lastTrack, byteIndex, amount)
+			}
+			m.ReplaceEditPattern(result)
+		},
+		func() {
+			m.ReplaceEditPattern(original)
+		},
+		b.id,
+	)
+}
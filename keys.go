@@ -10,6 +10,8 @@ type KeyMap struct {
 	Down                key.Binding
 	PageUp              key.Binding
 	PageDown            key.Binding
+	PrevBar             key.Binding
+	NextBar             key.Binding
 	JumpToFirstRow      key.Binding
 	JumpToLastRow       key.Binding
 	JumpToTopLeft       key.Binding
@@ -31,6 +33,15 @@ type KeyMap struct {
 	InsertBlock         key.Binding
 	DeleteBlock         key.Binding
 	ZeroBlock           key.Binding
+	TransposeUp         key.Binding
+	TransposeDown       key.Binding
+	TransposeDegreeUp   key.Binding
+	TransposeDegreeDown key.Binding
+	Interpolate         key.Binding
+	ReverseBlock        key.Binding
+	InvertBlock         key.Binding
+	RotateBlockUp       key.Binding
+	RotateBlockDown     key.Binding
 	BackspaceBlock      key.Binding
 	PlayOrStop          key.Binding
 	Cut                 key.Binding
@@ -40,6 +51,17 @@ type KeyMap struct {
 	EnterCommandMode    key.Binding
 	EnterNoteMode       key.Binding
 	ToggleChromaticMode key.Binding
+	ToggleChordMode     key.Binding
+	NoteOff             key.Binding
+	OctaveUp            key.Binding
+	OctaveDown          key.Binding
+	ToggleDisplayMode   key.Binding
+	EnterDefaultsMode   key.Binding
+	EnterDecimalMode    key.Binding
+	Increment           key.Binding
+	Decrement           key.Binding
+	IncrementCoarse     key.Binding
+	DecrementCoarse     key.Binding
 	Undo                key.Binding
 	Redo                key.Binding
 	Save                key.Binding
@@ -66,6 +88,14 @@ var defaultKeyMap = KeyMap{
 		key.WithKeys("pgdown"),
 		key.WithHelp("pgdown", "page down"),
 	),
+	PrevBar: key.NewBinding(
+		key.WithKeys("ctrl+pgup"),
+		key.WithHelp("C-pgup", "previous bar"),
+	),
+	NextBar: key.NewBinding(
+		key.WithKeys("ctrl+pgdown"),
+		key.WithHelp("C-pgdown", "next bar"),
+	),
 	JumpToFirstRow: key.NewBinding(
 		key.WithKeys("home"),
 		key.WithHelp("home", "first row"),
@@ -150,6 +180,42 @@ var defaultKeyMap = KeyMap{
 		key.WithKeys("."),
 		key.WithHelp(".", "fill selection with zeroes"),
 	),
+	TransposeUp: key.NewBinding(
+		key.WithKeys("+"),
+		key.WithHelp("+", "transpose up a semitone"),
+	),
+	TransposeDown: key.NewBinding(
+		key.WithKeys("-"),
+		key.WithHelp("-", "transpose down a semitone"),
+	),
+	TransposeDegreeUp: key.NewBinding(
+		key.WithKeys(">"),
+		key.WithHelp(">", "transpose up a scale degree"),
+	),
+	TransposeDegreeDown: key.NewBinding(
+		key.WithKeys("<"),
+		key.WithHelp("<", "transpose down a scale degree"),
+	),
+	Interpolate: key.NewBinding(
+		key.WithKeys("i"),
+		key.WithHelp("i", "interpolate selection"),
+	),
+	ReverseBlock: key.NewBinding(
+		key.WithKeys("alt+r"),
+		key.WithHelp("M-r", "reverse selection"),
+	),
+	InvertBlock: key.NewBinding(
+		key.WithKeys("alt+i"),
+		key.WithHelp("M-i", "invert selection"),
+	),
+	RotateBlockUp: key.NewBinding(
+		key.WithKeys("alt+up"),
+		key.WithHelp("M-up", "rotate selection up"),
+	),
+	RotateBlockDown: key.NewBinding(
+		key.WithKeys("alt+down"),
+		key.WithHelp("M-down", "rotate selection down"),
+	),
 	BackspaceBlock: key.NewBinding(
 		key.WithKeys("backspace"),
 		key.WithHelp("backspace", "delete block above"),
@@ -186,6 +252,50 @@ var defaultKeyMap = KeyMap{
 		key.WithKeys("N"),
 		key.WithHelp("S-n", "toggle chromatic mode"),
 	),
+	ToggleChordMode: key.NewBinding(
+		key.WithKeys("C"),
+		key.WithHelp("S-c", "toggle chord mode"),
+	),
+	NoteOff: key.NewBinding(
+		key.WithKeys("a"),
+		key.WithHelp("a", "note off"),
+	),
+	OctaveUp: key.NewBinding(
+		key.WithKeys("*"),
+		key.WithHelp("*", "octave up"),
+	),
+	OctaveDown: key.NewBinding(
+		key.WithKeys("/"),
+		key.WithHelp("/", "octave down"),
+	),
+	ToggleDisplayMode: key.NewBinding(
+		key.WithKeys("ctrl+d"),
+		key.WithHelp("C-d", "toggle hex/readable display"),
+	),
+	EnterDefaultsMode: key.NewBinding(
+		key.WithKeys("ctrl+t"),
+		key.WithHelp("C-t", "edit track defaults"),
+	),
+	EnterDecimalMode: key.NewBinding(
+		key.WithKeys("="),
+		key.WithHelp("=", "enter decimal value"),
+	),
+	Increment: key.NewBinding(
+		key.WithKeys("]"),
+		key.WithHelp("]", "increment value"),
+	),
+	Decrement: key.NewBinding(
+		key.WithKeys("["),
+		key.WithHelp("[", "decrement value"),
+	),
+	IncrementCoarse: key.NewBinding(
+		key.WithKeys("}"),
+		key.WithHelp("}", "increment value by 16"),
+	),
+	DecrementCoarse: key.NewBinding(
+		key.WithKeys("{"),
+		key.WithHelp("{", "decrement value by 16"),
+	),
 	Undo: key.NewBinding(
 		key.WithKeys("ctrl+z"),
 		key.WithHelp("C-z", "undo"),
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+)
+
+type LintIssue struct {
+	Row     int
+	Track   int
+	Message string
+}
+
+func (issue LintIssue) String() string {
+	return fmt.Sprintf("row %04X track %02X: %s", issue.Row, issue.Track, issue.Message)
+}
+
+// lintMessage checks a cell whose resolved form is the message playback
+// would send and returns a description of the problem or ""
+func lintMessage(msg, resolved MidiMessage) string {
+	if msg == (MidiMessage{}) {
+		return ""
+	}
+	status := resolved[0]
+	switch {
+	case msg[0] != 0 && msg[0] < 0x80:
+		return fmt.Sprintf("invalid status byte %02X", msg[0])
+	case status == 0:
+		return "missing status byte (track has no defaults)"
+	case status >= 0xF0:
+		switch status {
+		case CmdSetBPM, CmdSetLPB, CmdSetTPL:
+			if msg[1] == 0 && msg[2] == 0 {
+				return fmt.Sprintf("tempo command %02X without value", status)
+			}
+		default:
+			return fmt.Sprintf("unsupported system message %02X", status)
+		}
+	}
+	for i := 1; i < 3; i++ {
+		if msg[i] > 0x7f {
+			return fmt.Sprintf("data byte %02X out of range", msg[i])
+		}
+	}
+	if kind := status >> 4; (kind == 0xC || kind == 0xD) && msg[2] != 0 {
+		return fmt.Sprintf("stray third byte %02X in two-byte message", msg[2])
+	}
+	return ""
+}
+
+// Lint checks every cell of the pattern, status bytes are resolved from
+// the preceding rows and the track defaults like playback does
+func (p *Pattern) Lint() []LintIssue {
+	var issues []LintIssue
+	for t := range p.NumTracks {
+		defaults := p.TrackDefaults[t]
+		for y := range p.NumRows {
+			msg := p.Rows[y][t]
+			if problem := lintMessage(msg, applyTrackDefaults(msg, defaults)); problem != "" {
+				issues = append(issues, LintIssue{y, t, problem})
+			}
+			defaults = nextTrackDefaults(msg, defaults)
+		}
+	}
+	return issues
+}
+
+func (m *Model) Lint() {
+	p := m.song.Patterns[m.editPattern]
+	issues := p.Lint()
+	switch len(issues) {
+	case 0:
+		m.SetError(fmt.Errorf("no issues found"))
+	case 1:
+		m.SetError(fmt.Errorf("%s", issues[0]))
+	default:
+		m.SetError(fmt.Errorf("%d issues, first at %s", len(issues), issues[0]))
+	}
+}
+
+// LintSong reports the issues of all patterns of a song file
+func LintSong(filename string) (issues []string, err error) {
+	song, err := readSong(filename)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range song.Patterns {
+		if p == nil {
+			continue
+		}
+		for _, issue := range p.Lint() {
+			issues = append(issues, fmt.Sprintf("%s: pattern %02X %s", filename, i, issue))
+		}
+	}
+	return issues, nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"math"
+	"math/rand"
 )
 
 var defaultBrush = Brush{
@@ -37,6 +38,7 @@ func (m *Model) Reset() {
 	//m.editPattern
 	m.editPos.X = 0
 	m.editPos.Y = 0
+	m.noteField = 1
 	m.firstVisibleRow = 0
 	m.firstVisibleTrack = 0
 	m.playPattern = 0
@@ -53,6 +55,7 @@ func (m *Model) Reset() {
 	m.undoableActions = nil
 	m.undoneActions = nil
 	m.clipboard = nil
+	m.clipboardAttrs = nil
 	m.pasteOffset = 0
 	m.usingTempBrush = false
 }
@@ -99,6 +102,7 @@ func (m *Model) SetSong(song *Song) {
 	m.Reset()
 	m.song = song
 	m.fix()
+	m.invalidatePatternDurations()
 }
 
 func (m *Model) ReplaceEditPattern(p *Pattern) {
@@ -108,12 +112,23 @@ func (m *Model) ReplaceEditPattern(p *Pattern) {
 
 func (m *Model) Play() {
 	m.playTick = 0
+	m.nextTickFrame = m.playFrame
+	m.playBPM = m.song.BPM
+	m.playLPB = m.song.LPB
+	m.playTPL = m.song.TPL
+	m.rng = rand.New(rand.NewSource(m.song.Seed))
+	m.resetTrackStates(m.song.Patterns[m.playPattern])
+	m.tickCount = 0
+	m.releaseScheduledNoteOffs()
 	m.isPlaying = true
 }
 
 func (m *Model) Stop() {
 	m.isPlaying = false
 	m.playTick = 0
+	m.releaseScheduledNoteOffs()
+	m.releasePitchBends()
+	m.releaseArpNotes()
 }
 
 func (m *Model) Quit() tea.Cmd {
@@ -144,6 +159,24 @@ func (m *Model) GetTicksPerBeat() int {
 	return m.song.TPL * m.song.LPB
 }
 
+func (m *Model) GetTimeSignature(p *Pattern) (beatsPerBar, beatUnit int) {
+	beatsPerBar = m.song.BeatsPerBar
+	if p.BeatsPerBar > 0 {
+		beatsPerBar = p.BeatsPerBar
+	}
+	beatUnit = m.song.BeatUnit
+	if p.BeatUnit > 0 {
+		beatUnit = p.BeatUnit
+	}
+	return beatsPerBar, beatUnit
+}
+
+func (m *Model) GetRowsPerBar(p *Pattern) int {
+	beatsPerBar, beatUnit := m.GetTimeSignature(p)
+	// LPB counts lines per quarter note
+	return max(1, m.song.LPB*beatsPerBar*4/beatUnit)
+}
+
 func (m *Model) GetFramesPerTick() int {
 	sr := float64(m.GetSampleRate())
 	bps := m.GetBeatsPerSecond()
@@ -152,9 +185,12 @@ func (m *Model) GetFramesPerTick() int {
 }
 
 func (m *Model) GetRootNoteAsString() string {
-	root := m.song.Root
-	octave := root / 12
-	degree := root % 12
+	return formatNote(m.song.Root)
+}
+
+func formatNote(midiNote int) string {
+	octave := midiNote / 12
+	degree := midiNote % 12
 	var note string
 	switch degree {
 	case 0:
@@ -225,49 +261,56 @@ processPendingMidiMessages:
 			break processPendingMidiMessages
 		}
 	}
+	for _, msg := range m.releaseMessages {
+		midiData.Time = 0
+		midiData.Buffer = msg.bytes()
+		outPort.MidiEventWrite(&midiData, buf)
+	}
+	m.releaseMessages = m.releaseMessages[:0]
 	if !m.isPlaying {
 		m.playFrame += uint64(nframes)
 		return 0
 	}
-	framesPerTick := uint64(m.GetFramesPerTick())
-	p := m.song.Patterns[m.playPattern]
 	for i := range nframes {
-		if m.playFrame%framesPerTick == 0 {
-			if m.playTick == 0 {
-				row := p.Rows[m.playRow]
-				for numTrack, msg := range row {
-					if msg[0] == 0 && (msg[1] != 0 || msg[2] != 0) {
-						defaults := p.TrackDefaults[numTrack]
-						for j := range 3 {
-							if msg[j] == 0 {
-								msg[j] = defaults[j]
-							}
-						}
-					}
-					if msg[0] >= 0x80 {
-						midiData.Time = i
-						midiData.Buffer = msg.bytes()
-						outPort.MidiEventWrite(&midiData, buf)
-						p.TrackDefaults[numTrack] = msg
-					}
-				}
-			}
-			m.playTick++
-			if m.playTick >= m.song.TPL {
-				m.playRow++
-				if m.playRow == p.NumRows {
-					// TODO: advance to next pattern in sequence
-					m.playRow = 0
-				}
-				m.playTick = 0
+		if m.playFrame >= m.nextTickFrame {
+			redraw := m.processTick(func(msg MidiMessage) {
+				midiData.Time = i
+				midiData.Buffer = msg.bytes()
+				outPort.MidiEventWrite(&midiData, buf)
+			})
+			if redraw {
 				m.msgs <- redrawMsg{}
 			}
+			m.nextTickFrame += uint64(m.GetPlayFramesPerTick())
 		}
 		m.playFrame++
 	}
 	return 0
 }
 
+func (m *Model) processTick(emit func(MidiMessage)) (redraw bool) {
+	p := m.song.Patterns[m.playPattern]
+	m.processScheduledMessages(p, emit)
+	for numTrack := range p.NumTracks {
+		if m.processTrackTick(p, numTrack, emit) {
+			redraw = true
+		}
+	}
+	m.processTrackEffects(p, emit)
+	m.tickCount++
+	m.playTick++
+	if m.playTick >= m.playTPL {
+		m.playRow++
+		if m.playRow == p.NumRows {
+			// TODO: advance to next pattern in sequence
+			m.playRow = 0
+		}
+		m.playTick = 0
+		redraw = true
+	}
+	return redraw
+}
+
 func (m *Model) Init() tea.Cmd {
 	m.keymap = &defaultKeyMap
 	m.midiEngine = &MidiEngine{}
@@ -282,6 +325,7 @@ func (m *Model) Init() tea.Cmd {
 	}
 	FixSong(m.song)
 	m.song.Patterns[0] = makeDefaultPattern()
+	m.trackStates = makeTrackStates(m.song.maxNumTracks())
 	m.commandModel = textinput.New()
 	m.pendingActions = make(chan Action, 64)
 	m.pendingMidiMessages = make(chan MidiMessage, 64)
@@ -303,22 +347,26 @@ func (m *Model) getDigit() byte {
 	return p.getDigit(m.editPos.X, m.editPos.Y)
 }
 
-func (m *Model) setDigit(b byte) {
-	p := m.song.Patterns[m.editPattern]
-	p.setDigit(m.editPos.X, m.editPos.Y, b)
-}
-
+// insertDigit writes a digit at the cursor and moves on to the next
+// one, the cursor moves here on the UI thread and not in the action
 func (m *Model) insertDigit(b byte) {
-	m.setDigit(b)
-	m.Right()
-}
-
-func (m *Model) getNoteByte() byte {
+	pos := m.editPos
 	p := m.song.Patterns[m.editPattern]
-	noteOffset := m.editPos.X - m.editPos.X%6 + 2
-	hi := p.getDigit(noteOffset, m.editPos.Y)
-	lo := p.getDigit(noteOffset+1, m.editPos.Y)
-	return hi<<4 + lo
+	prevDigit := m.getDigit()
+	msg := p.Rows[pos.Y][pos.X/6]
+	msg.setDigit(pos.X%6, b)
+	m.submitAction(
+		func() {
+			m.song.Patterns[m.editPattern].setDigit(pos.X, pos.Y, b)
+		},
+		func() {
+			m.song.Patterns[m.editPattern].setDigit(pos.X, pos.Y, prevDigit)
+			m.moveBrush(pos.X-m.editPos.X, pos.Y-m.editPos.Y)
+		},
+		0,
+	)
+	m.updateCellStatus(pos.X/6, msg)
+	m.Right()
 }
 
 func (m *Model) setNoteByte(midiNote byte) {
@@ -328,6 +376,24 @@ func (m *Model) setNoteByte(midiNote byte) {
 	p.setDigit(noteOffset+1, m.editPos.Y, midiNote&0x0f)
 }
 
+func (m *Model) previewNote(numTrack int, note, velocity byte) {
+	msg := MidiMessage{0x90, note, velocity}
+	p := m.song.Patterns[m.editPattern]
+	if status := p.resolveStatus(m.editPos.Y, numTrack); status >= 0x80 && status < 0xf0 {
+		msg[0] = 0x90 + status&0x0f
+	}
+	for y := m.editPos.Y; y >= 0 && msg[2] == 0; y-- {
+		msg[2] = p.Rows[y][numTrack][2]
+	}
+	if msg[2] == 0 {
+		msg[2] = p.TrackDefaults[numTrack][2]
+	}
+	if msg[2] == 0 {
+		msg[2] = 0x70
+	}
+	m.pendingMidiMessages <- msg
+}
+
 type MessageHandler func(m *Model, msg tea.Msg) (cmds []tea.Cmd)
 
 var modeSpecificMessageHandlers = map[Mode]MessageHandler{
@@ -341,16 +407,7 @@ var modeSpecificMessageHandlers = map[Mode]MessageHandler{
 					value = value - 0x61 + 0x3a
 				}
 				value -= 0x30
-				prevDigit := m.getDigit()
-				m.submitAction(
-					func() {
-						m.insertDigit(value)
-					},
-					func() {
-						m.Left()
-						m.setDigit(prevDigit)
-					},
-				)
+				m.insertDigit(value)
 			default:
 				switch {
 				case key.Matches(msg, m.keymap.Quit):
@@ -363,6 +420,10 @@ var modeSpecificMessageHandlers = map[Mode]MessageHandler{
 					m.PageUp()
 				case key.Matches(msg, m.keymap.PageDown):
 					m.PageDown()
+				case key.Matches(msg, m.keymap.PrevBar):
+					m.PrevBar()
+				case key.Matches(msg, m.keymap.NextBar):
+					m.NextBar()
 				case key.Matches(msg, m.keymap.JumpToFirstRow):
 					m.JumpToFirstRow()
 				case key.Matches(msg, m.keymap.JumpToLastRow):
@@ -383,6 +444,20 @@ var modeSpecificMessageHandlers = map[Mode]MessageHandler{
 					m.InsertTrack()
 				case key.Matches(msg, m.keymap.DeleteTrack):
 					m.DeleteTrack()
+				case key.Matches(msg, m.keymap.ToggleDisplayMode):
+					m.ToggleDisplayMode()
+				case key.Matches(msg, m.keymap.EnterDefaultsMode):
+					m.EnterMode(DefaultsMode)
+				case key.Matches(msg, m.keymap.EnterDecimalMode):
+					m.EnterDecimalMode(m.editPos.X, m.editPos.Y, "")
+				case key.Matches(msg, m.keymap.Increment):
+					m.IncrementSelection(1)
+				case key.Matches(msg, m.keymap.Decrement):
+					m.IncrementSelection(-1)
+				case key.Matches(msg, m.keymap.IncrementCoarse):
+					m.IncrementSelection(16)
+				case key.Matches(msg, m.keymap.DecrementCoarse):
+					m.IncrementSelection(-16)
 				case key.Matches(msg, m.keymap.IncBrushWidth):
 					m.IncBrushWidth()
 				case key.Matches(msg, m.keymap.DecBrushWidth):
@@ -421,6 +496,30 @@ var modeSpecificMessageHandlers = map[Mode]MessageHandler{
 					m.applyTempBrush(2)
 					m.ZeroBlock()
 					m.revertTempBrush()
+				case key.Matches(msg, m.keymap.TransposeUp):
+					m.TransposeSelection(1, false)
+				case key.Matches(msg, m.keymap.TransposeDown):
+					m.TransposeSelection(-1, false)
+				case key.Matches(msg, m.keymap.TransposeDegreeUp):
+					m.TransposeSelection(1, true)
+				case key.Matches(msg, m.keymap.TransposeDegreeDown):
+					m.TransposeSelection(-1, true)
+				case key.Matches(msg, m.keymap.Interpolate):
+					m.InterpolateSelection(CurveLinear)
+				case key.Matches(msg, m.keymap.ReverseBlock):
+					m.applyTempBrush(6)
+					m.ReverseSelection()
+					m.revertTempBrush()
+				case key.Matches(msg, m.keymap.InvertBlock):
+					m.InvertSelection(-1)
+				case key.Matches(msg, m.keymap.RotateBlockUp):
+					m.applyTempBrush(6)
+					m.RotateSelection(-1)
+					m.revertTempBrush()
+				case key.Matches(msg, m.keymap.RotateBlockDown):
+					m.applyTempBrush(6)
+					m.RotateSelection(1)
+					m.revertTempBrush()
 				case key.Matches(msg, m.keymap.Cut):
 					m.applyTempBrush(6)
 					m.Cut()
@@ -453,43 +552,19 @@ var modeSpecificMessageHandlers = map[Mode]MessageHandler{
 	NoteMode: func(m *Model, msg tea.Msg) (cmds []tea.Cmd) {
 		switch msg := msg.(type) {
 		case tea.KeyMsg:
+			if s := msg.String(); m.smartCursor && m.noteField != 1 && len(s) == 1 && s[0] >= '0' && s[0] <= '9' {
+				m.EnterDecimalMode(m.CurrentTrack()*6+m.noteField*2, m.editPos.Y, s)
+				return cmds
+			}
 			midiNote := m.KeyMsgToMidiNote(msg)
-			if midiNote >= 0 {
-				prevNote := m.getNoteByte()
-				m.submitAction(
-					func() {
-						m.setNoteByte(byte(midiNote))
-					},
-					func() {
-						m.setNoteByte(prevNote)
-					},
-				)
-				msg := MidiMessage{0, byte(midiNote), 0}
-				p := m.song.Patterns[m.editPattern]
-				numTrack := m.editPos.X / 6
-				for y := m.editPos.Y; y >= 0 && msg[0] == 0 && msg[2] == 0; y-- {
-					ymsg := p.Rows[y][numTrack]
-					if msg[0] == 0 && ymsg[0] != 0 {
-						msg[0] = 0x90 + ymsg[0]&0x0f
-					}
-					if msg[2] == 0 && ymsg[2] != 0 {
-						msg[2] = ymsg[2]
-					}
-				}
-				defaults := p.TrackDefaults[numTrack]
-				if msg[0] == 0 && defaults[0] != 0 {
-					msg[0] = 0x90 + defaults[0]&0x0f
-				}
-				if msg[2] == 0 && defaults[2] != 0 {
-					msg[2] = defaults[2]
+			if midiNote >= 0 && m.chordMode {
+				firstTrack := m.CurrentTrack()
+				for i, note := range m.EnterChord(midiNote) {
+					m.previewNote(firstTrack+i, byte(note), byte(m.entryVelocity))
 				}
-				if msg[0] == 0 {
-					msg[0] = 0x90
-				}
-				if msg[2] == 0 {
-					msg[2] = 0x70
-				}
-				m.pendingMidiMessages <- msg
+				m.advanceEditStep()
+			} else if midiNote >= 0 {
+				m.EnterNote(midiNote)
 			} else {
 				switch {
 				case key.Matches(msg, m.keymap.Quit):
@@ -502,10 +577,18 @@ var modeSpecificMessageHandlers = map[Mode]MessageHandler{
 					m.PageUp()
 				case key.Matches(msg, m.keymap.PageDown):
 					m.PageDown()
+				case key.Matches(msg, m.keymap.PrevBar):
+					m.PrevBar()
+				case key.Matches(msg, m.keymap.NextBar):
+					m.NextBar()
 				case key.Matches(msg, m.keymap.JumpToFirstRow):
 					m.JumpToFirstRow()
 				case key.Matches(msg, m.keymap.JumpToLastRow):
 					m.JumpToLastRow()
+				case key.Matches(msg, m.keymap.Left) && m.smartCursor:
+					m.PrevNoteField()
+				case key.Matches(msg, m.keymap.Right) && m.smartCursor:
+					m.NextNoteField()
 				case key.Matches(msg, m.keymap.Left):
 					m.PrevTrack()
 				case key.Matches(msg, m.keymap.Right):
@@ -518,6 +601,8 @@ var modeSpecificMessageHandlers = map[Mode]MessageHandler{
 					m.InsertTrack()
 				case key.Matches(msg, m.keymap.DeleteTrack):
 					m.DeleteTrack()
+				case key.Matches(msg, m.keymap.EnterDecimalMode):
+					m.EnterDecimalMode(m.CurrentTrack()*6+m.noteField*2, m.editPos.Y, "")
 				case key.Matches(msg, m.keymap.IncSelectionWidth):
 					if m.song.Root < 127 {
 						m.song.Root++
@@ -566,6 +651,16 @@ var modeSpecificMessageHandlers = map[Mode]MessageHandler{
 					m.EnterCommandMode()
 				case key.Matches(msg, m.keymap.ToggleChromaticMode):
 					m.ToggleChromaticMode()
+				case key.Matches(msg, m.keymap.ToggleChordMode):
+					m.ToggleChordMode()
+				case key.Matches(msg, m.keymap.ToggleDisplayMode):
+					m.ToggleDisplayMode()
+				case key.Matches(msg, m.keymap.NoteOff):
+					m.EnterNoteOff()
+				case key.Matches(msg, m.keymap.OctaveUp):
+					m.OctaveUp()
+				case key.Matches(msg, m.keymap.OctaveDown):
+					m.OctaveDown()
 				case key.Matches(msg, m.keymap.EnterNoteMode):
 					m.LeaveMode()
 				case key.Matches(msg, m.keymap.Undo):
@@ -600,6 +695,34 @@ var modeSpecificMessageHandlers = map[Mode]MessageHandler{
 				m.DeleteBlock(true)
 			case key.Matches(msg, m.keymap.ZeroBlock):
 				m.ZeroBlock()
+			case key.Matches(msg, m.keymap.TransposeUp):
+				m.TransposeSelection(1, false)
+			case key.Matches(msg, m.keymap.TransposeDown):
+				m.TransposeSelection(-1, false)
+			case key.Matches(msg, m.keymap.TransposeDegreeUp):
+				m.TransposeSelection(1, true)
+			case key.Matches(msg, m.keymap.TransposeDegreeDown):
+				m.TransposeSelection(-1, true)
+			case key.Matches(msg, m.keymap.Interpolate):
+				m.InterpolateSelection(CurveLinear)
+			case key.Matches(msg, m.keymap.ReverseBlock):
+				m.ReverseSelection()
+			case key.Matches(msg, m.keymap.InvertBlock):
+				m.InvertSelection(-1)
+			case key.Matches(msg, m.keymap.RotateBlockUp):
+				m.RotateSelection(-1)
+			case key.Matches(msg, m.keymap.RotateBlockDown):
+				m.RotateSelection(1)
+			case key.Matches(msg, m.keymap.Increment):
+				m.IncrementSelection(1)
+			case key.Matches(msg, m.keymap.Decrement):
+				m.IncrementSelection(-1)
+			case key.Matches(msg, m.keymap.IncrementCoarse):
+				m.IncrementSelection(16)
+			case key.Matches(msg, m.keymap.DecrementCoarse):
+				m.IncrementSelection(-16)
+			case key.Matches(msg, m.keymap.EnterCommandMode):
+				m.EnterCommandMode()
 			case key.Matches(msg, m.keymap.NextTrack):
 				m.brush.Y = m.sel.Y
 				m.editPos.Y = m.sel.Y
@@ -628,6 +751,59 @@ var modeSpecificMessageHandlers = map[Mode]MessageHandler{
 		}
 		return cmds
 	},
+	DefaultsMode: func(m *Model, msg tea.Msg) (cmds []tea.Cmd) {
+		switch msg := msg.(type) {
+		case tea.KeyMsg:
+			switch msg.String() {
+			case "0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "a", "b", "c", "d", "e", "f":
+				value := byte(msg.Runes[0])
+				if value >= 0x61 {
+					value = value - 0x61 + 0x3a
+				}
+				value -= 0x30
+				m.SetTrackDefaultsDigit(value)
+				m.Right()
+			default:
+				switch {
+				case key.Matches(msg, m.keymap.Quit):
+					cmds = append(cmds, m.Quit())
+				case key.Matches(msg, m.keymap.Left):
+					m.Left()
+				case key.Matches(msg, m.keymap.Right):
+					m.Right()
+				case key.Matches(msg, m.keymap.NextTrack):
+					m.NextTrack()
+				case key.Matches(msg, m.keymap.PrevTrack):
+					m.PrevTrack()
+				case key.Matches(msg, m.keymap.ZeroBlock):
+					m.SetTrackDefaultsDigit(0)
+					m.Right()
+				case key.Matches(msg, m.keymap.EnterDefaultsMode):
+					m.LeaveMode()
+				case key.Matches(msg, m.keymap.Undo):
+					m.Undo()
+				case key.Matches(msg, m.keymap.Redo):
+					m.Redo()
+				case key.Matches(msg, m.keymap.Save):
+					m.SaveSong()
+				}
+			}
+		}
+		return cmds
+	},
+	DecimalMode: func(m *Model, msg tea.Msg) (cmds []tea.Cmd) {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch msg.String() {
+			case "0", "1", "2", "3", "4", "5", "6", "7", "8", "9":
+				m.AppendDecimalDigit(msg.Runes[0])
+			case "backspace":
+				m.BackspaceDecimalDigit()
+			case "enter":
+				m.CommitDecimalInput()
+			}
+		}
+		return cmds
+	},
 	CommandMode: func(m *Model, msg tea.Msg) (cmds []tea.Cmd) {
 		var cmd tea.Cmd
 		m.commandModel, cmd = m.commandModel.Update(msg)
@@ -658,7 +834,15 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 	switch msg := msg.(type) {
 	case Action:
-		if msg.undoFn != nil {
+		m.invalidatePatternDurations()
+		m.invalidateCellStatuses()
+		if msg.burst != m.incrementBurst.id {
+			// the pattern changed outside of the burst
+			m.incrementBurst.original = nil
+		}
+		if n := len(m.undoableActions); msg.undoFn != nil && msg.burst != 0 && n > 0 && m.undoableActions[n-1].burst == msg.burst {
+			m.undoableActions[n-1] = msg
+		} else if msg.undoFn != nil {
 			m.undoableActions = append(m.undoableActions, msg)
 			if len(m.undoableActions) > MaxUndoableActions {
 				m.undoableActions = m.undoableActions[len(m.undoableActions)-MaxUndoableActions:]
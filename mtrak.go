@@ -10,10 +10,14 @@ import (
 var program *tea.Program
 
 func main() {
-	m := &Model{}
-	defer m.Close()
+	lint := flag.Bool("lint", false, "check song files for invalid MIDI data and exit")
 	flag.Parse()
 	args := flag.Args()
+	if *lint {
+		os.Exit(lintFiles(args))
+	}
+	m := &Model{}
+	defer m.Close()
 	if len(args) > 0 {
 		if len(args) > 1 {
 			fmt.Fprintln(os.Stderr, "Usage: mtrak [filename]")
@@ -31,3 +35,19 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+func lintFiles(filenames []string) (exitCode int) {
+	for _, filename := range filenames {
+		issues, err := LintSong(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		for _, issue := range issues {
+			fmt.Println(issue)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
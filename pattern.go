@@ -1,20 +1,27 @@
 package main
 
 import (
+	"fmt"
 	"slices"
+	"strings"
 )
 
 func makePattern(rowCount, trackCount int) *Pattern {
 	rows := make([]Row, rowCount)
+	attrs := make([][]CellAttrs, rowCount)
 	for i := range rowCount {
 		rows[i] = make(Row, trackCount)
+		attrs[i] = make([]CellAttrs, trackCount)
 	}
 	trackDefaults := make(Row, trackCount)
+	trackSettings := make([]TrackSettings, trackCount)
 	return &Pattern{
 		Rows:          rows,
 		NumRows:       rowCount,
 		NumTracks:     trackCount,
 		TrackDefaults: trackDefaults,
+		TrackSettings: trackSettings,
+		Attrs:         attrs,
 	}
 }
 
@@ -22,6 +29,20 @@ func makeDefaultPattern() *Pattern {
 	return makePattern(64, 16)
 }
 
+func (p *Pattern) fix() {
+	for len(p.TrackSettings) < p.NumTracks {
+		p.TrackSettings = append(p.TrackSettings, TrackSettings{})
+	}
+	for len(p.Attrs) < p.NumRows {
+		p.Attrs = append(p.Attrs, nil)
+	}
+	for y := range p.Attrs {
+		for len(p.Attrs[y]) < p.NumTracks {
+			p.Attrs[y] = append(p.Attrs[y], CellAttrs{})
+		}
+	}
+}
+
 func (p *Pattern) Width() int {
 	return p.NumTracks * 6
 }
@@ -34,8 +55,13 @@ func (p *Pattern) clone() *Pattern {
 	clone := makePattern(p.NumRows, p.NumTracks)
 	for rowIndex := 0; rowIndex < p.NumRows; rowIndex++ {
 		clone.Rows[rowIndex] = slices.Clone(p.Rows[rowIndex])
+		clone.Attrs[rowIndex] = slices.Clone(p.Attrs[rowIndex])
 	}
 	clone.TrackDefaults = slices.Clone(p.TrackDefaults)
+	clone.Swing = p.Swing
+	clone.BeatsPerBar = p.BeatsPerBar
+	clone.BeatUnit = p.BeatUnit
+	clone.TrackSettings = slices.Clone(p.TrackSettings)
 	return clone
 }
 
@@ -47,14 +73,29 @@ func (p *Pattern) insertTracks(at, count int) *Pattern {
 		drow = slices.Replace(drow, at+count, len(drow), srow[at:]...)
 		rows = append(rows, drow)
 	}
+	attrs := make([][]CellAttrs, 0, p.NumRows)
+	for _, srow := range p.Attrs {
+		drow := make([]CellAttrs, p.NumTracks+count)
+		drow = slices.Replace(drow, 0, at, srow[:at]...)
+		drow = slices.Replace(drow, at+count, len(drow), srow[at:]...)
+		attrs = append(attrs, drow)
+	}
 	trackDefaults := make(Row, p.NumTracks+count)
 	trackDefaults = slices.Replace(trackDefaults, 0, at, p.TrackDefaults[:at]...)
 	trackDefaults = slices.Replace(trackDefaults, at+count, len(trackDefaults), p.TrackDefaults[at:]...)
+	trackSettings := make([]TrackSettings, p.NumTracks+count)
+	trackSettings = slices.Replace(trackSettings, 0, at, p.TrackSettings[:at]...)
+	trackSettings = slices.Replace(trackSettings, at+count, len(trackSettings), p.TrackSettings[at:]...)
 	return &Pattern{
 		Rows:          rows,
 		NumRows:       p.NumRows,
 		NumTracks:     p.NumTracks + count,
 		TrackDefaults: trackDefaults,
+		Swing:         p.Swing,
+		BeatsPerBar:   p.BeatsPerBar,
+		BeatUnit:      p.BeatUnit,
+		TrackSettings: trackSettings,
+		Attrs:         attrs,
 	}
 }
 
@@ -66,14 +107,29 @@ func (p *Pattern) deleteTracks(at, count int) *Pattern {
 		drow = slices.Replace(drow, at, len(drow), srow[at+count:]...)
 		rows = append(rows, drow)
 	}
+	attrs := make([][]CellAttrs, 0, p.NumRows)
+	for _, srow := range p.Attrs {
+		drow := make([]CellAttrs, p.NumTracks-count)
+		drow = slices.Replace(drow, 0, at, srow[:at]...)
+		drow = slices.Replace(drow, at, len(drow), srow[at+count:]...)
+		attrs = append(attrs, drow)
+	}
 	trackDefaults := make(Row, p.NumTracks-count)
 	trackDefaults = slices.Replace(trackDefaults, 0, at, p.TrackDefaults[:at]...)
 	trackDefaults = slices.Replace(trackDefaults, at, len(trackDefaults), p.TrackDefaults[at+count:]...)
+	trackSettings := make([]TrackSettings, p.NumTracks-count)
+	trackSettings = slices.Replace(trackSettings, 0, at, p.TrackSettings[:at]...)
+	trackSettings = slices.Replace(trackSettings, at, len(trackSettings), p.TrackSettings[at+count:]...)
 	return &Pattern{
 		Rows:          rows,
 		NumRows:       p.NumRows,
 		NumTracks:     p.NumTracks - count,
 		TrackDefaults: trackDefaults,
+		Swing:         p.Swing,
+		BeatsPerBar:   p.BeatsPerBar,
+		BeatUnit:      p.BeatUnit,
+		TrackSettings: trackSettings,
+		Attrs:         attrs,
 	}
 }
 
@@ -97,6 +153,14 @@ func appendEmptyRows(rows []Row, count int, numTracks int) []Row {
 	return rows
 }
 
+func appendEmptyAttrRows(attrs [][]CellAttrs, count int, numTracks int) [][]CellAttrs {
+	for range count {
+		emptyRow := make([]CellAttrs, numTracks)
+		attrs = append(attrs, emptyRow)
+	}
+	return attrs
+}
+
 func (p *Pattern) insertRows(at, count int) *Pattern {
 	rows := make([]Row, 0, p.NumRows+count)
 	for y, srow := range p.Rows {
@@ -108,12 +172,28 @@ func (p *Pattern) insertRows(at, count int) *Pattern {
 	if at == p.NumRows {
 		rows = appendEmptyRows(rows, count, p.NumTracks)
 	}
+	attrs := make([][]CellAttrs, 0, p.NumRows+count)
+	for y, srow := range p.Attrs {
+		if at == y {
+			attrs = appendEmptyAttrRows(attrs, count, p.NumTracks)
+		}
+		attrs = append(attrs, slices.Clone(srow))
+	}
+	if at == p.NumRows {
+		attrs = appendEmptyAttrRows(attrs, count, p.NumTracks)
+	}
 	trackDefaults := slices.Clone(p.TrackDefaults)
+	trackSettings := slices.Clone(p.TrackSettings)
 	return &Pattern{
 		Rows:          rows,
 		NumRows:       p.NumRows + count,
 		NumTracks:     p.NumTracks,
 		TrackDefaults: trackDefaults,
+		Swing:         p.Swing,
+		BeatsPerBar:   p.BeatsPerBar,
+		BeatUnit:      p.BeatUnit,
+		TrackSettings: trackSettings,
+		Attrs:         attrs,
 	}
 }
 
@@ -127,12 +207,25 @@ func (p *Pattern) deleteRows(at, count int) *Pattern {
 		srow := p.Rows[y+count]
 		rows = append(rows, slices.Clone(srow))
 	}
+	attrs := make([][]CellAttrs, 0, p.NumRows-count)
+	for y := range at {
+		attrs = append(attrs, slices.Clone(p.Attrs[y]))
+	}
+	for y := at; y < p.NumRows-count; y++ {
+		attrs = append(attrs, slices.Clone(p.Attrs[y+count]))
+	}
 	trackDefaults := slices.Clone(p.TrackDefaults)
+	trackSettings := slices.Clone(p.TrackSettings)
 	return &Pattern{
 		Rows:          rows,
 		NumRows:       p.NumRows - count,
 		NumTracks:     p.NumTracks,
 		TrackDefaults: trackDefaults,
+		Swing:         p.Swing,
+		BeatsPerBar:   p.BeatsPerBar,
+		BeatUnit:      p.BeatUnit,
+		TrackSettings: trackSettings,
+		Attrs:         attrs,
 	}
 }
 
@@ -160,6 +253,37 @@ func (p *Pattern) setDigit(x, y int, b byte) {
 	msg.setDigit(x%6, b)
 }
 
+func (p *Pattern) resolveStatus(y, t int) byte {
+	for ; y >= 0; y-- {
+		if status := p.Rows[y][t][0]; status != 0 {
+			return status
+		}
+	}
+	return p.TrackDefaults[t][0]
+}
+
+// applyTrackDefaults fills the missing bytes of a message from the
+// track defaults the way playback does
+func applyTrackDefaults(msg, defaults MidiMessage) MidiMessage {
+	if msg[0] == 0 && (msg[1] != 0 || msg[2] != 0) {
+		for j := range 3 {
+			if msg[j] == 0 {
+				msg[j] = defaults[j]
+			}
+		}
+	}
+	return msg
+}
+
+// nextTrackDefaults returns the track defaults after playing msg
+func nextTrackDefaults(msg, defaults MidiMessage) MidiMessage {
+	msg = applyTrackDefaults(msg, defaults)
+	if msg[0] >= 0x80 && msg[0] < 0xF0 {
+		return msg
+	}
+	return defaults
+}
+
 func (p *Pattern) getBlock(r Rect) Block {
 	result := make(Block, r.H)
 	for dy := 0; dy < r.H; dy++ {
@@ -185,9 +309,53 @@ func (p *Pattern) zeroBlock(r Rect) {
 			p.setDigit(r.X+dx, r.Y+dy, 0)
 		}
 	}
+	p.setAttrs(r, nil)
+}
+
+func (a CellAttrs) String() string {
+	var parts []string
+	if a.Cond.Kind != CondNone {
+		parts = append(parts, a.Cond.String())
+	}
+	if a.Delay > 0 {
+		parts = append(parts, fmt.Sprintf("+%dt", a.Delay))
+	}
+	if a.hasGate() {
+		parts = append(parts, fmt.Sprintf("g%d+%d", a.GateRows, a.GateTicks))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (p *Pattern) getAttrs(r Rect) [][]CellAttrs {
+	// attributes belong to the cell whose status digit is inside the rect
+	firstTrack := (r.X + 5) / 6
+	lastTrack := (r.X + r.W - 1) / 6
+	result := make([][]CellAttrs, r.H)
+	for dy := 0; dy < r.H; dy++ {
+		for t := firstTrack; t <= lastTrack; t++ {
+			result[dy] = append(result[dy], p.Attrs[r.Y+dy][t])
+		}
+	}
+	return result
+}
+
+func (p *Pattern) setAttrs(r Rect, attrs [][]CellAttrs) {
+	firstTrack := (r.X + 5) / 6
+	lastTrack := (r.X + r.W - 1) / 6
+	for dy := 0; dy < r.H; dy++ {
+		for t := firstTrack; t <= lastTrack; t++ {
+			var cellAttrs CellAttrs
+			if attrs != nil {
+				cellAttrs = attrs[dy][t-firstTrack]
+			}
+			p.Attrs[r.Y+dy][t] = cellAttrs
+		}
+	}
 }
 
 func (p *Pattern) copyBlock(r Rect, dx, dy int) {
 	block := p.getBlock(r)
+	attrs := p.getAttrs(r)
 	p.setBlock(Rect{r.X + dx, r.Y + dy, r.W, r.H}, block)
+	p.setAttrs(Rect{r.X + dx, r.Y + dy, r.W, r.H}, attrs)
 }
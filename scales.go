@@ -144,15 +144,49 @@ var keysToScaleDegreesInChromaticMode = map[string]int{
 	"i": 24,
 }
 
+func floorDivMod(a, b int) (q, r int) {
+	q, r = a/b, a%b
+	if r < 0 {
+		q--
+		r += b
+	}
+	return q, r
+}
+
 func (m *Model) DegreeToMidiNote(degree int) int {
 	scaleId := m.song.Scale
 	scale := scales[scaleId]
 	scaleSize := len(scale)
 	degree += m.song.Mode
-	return min(m.song.Root+(degree/scaleSize)*12+scale[degree%scaleSize], 127)
+	octave, index := floorDivMod(degree, scaleSize)
+	return max(0, min(m.song.Root+octave*12+scale[index], 127))
+}
+
+// MidiNoteToDegree returns the degree of the nearest scale note at or
+// below note and the distance of note from it in semitones
+func (m *Model) MidiNoteToDegree(note int) (degree int, offset int) {
+	scaleId := m.song.Scale
+	scale := scales[scaleId]
+	scaleSize := len(scale)
+	octave, pitchClass := floorDivMod(note-m.song.Root, 12)
+	index := 0
+	for i, step := range scale {
+		if step <= pitchClass {
+			index = i
+		}
+	}
+	return octave*scaleSize + index - m.song.Mode, pitchClass - scale[index]
 }
 
 func (m *Model) KeyMsgToMidiNote(msg tea.KeyMsg) int {
+	note := m.keyMsgToMidiNote(msg)
+	if note < 0 {
+		return note
+	}
+	return max(0, min(note+m.noteOctave*12, 127))
+}
+
+func (m *Model) keyMsgToMidiNote(msg tea.KeyMsg) int {
 	if m.song.Chromatic {
 		if degree, ok := keysToScaleDegreesInChromaticMode[msg.String()]; ok {
 			return min(m.song.Root+degree, 127)
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"os"
+	"slices"
+	"time"
+)
+
+type smfEvent struct {
+	tick int
+	data []byte
+}
+
+func writeVarLen(buf *bytes.Buffer, value int) {
+	var tmp [4]byte
+	n := 0
+	for {
+		tmp[n] = byte(value & 0x7f)
+		n++
+		value >>= 7
+		if value == 0 {
+			break
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		b := tmp[i]
+		if i > 0 {
+			b |= 0x80
+		}
+		buf.WriteByte(b)
+	}
+}
+
+func tempoEvent(tick int, usPerQuarter int) smfEvent {
+	usPerQuarter = min(usPerQuarter, 0xffffff)
+	return smfEvent{tick, []byte{0xff, 0x51, 0x03, byte(usPerQuarter >> 16), byte(usPerQuarter >> 8), byte(usPerQuarter)}}
+}
+
+func timeSignatureEvent(tick int, beatsPerBar, beatUnit int) smfEvent {
+	dd := byte(bits.Len(uint(beatUnit)) - 1)
+	return smfEvent{tick, []byte{0xff, 0x58, 0x04, byte(beatsPerBar), dd, 24, 8}}
+}
+
+func (s *Song) clone() *Song {
+	clone := *s
+	clone.Patterns = make([]*Pattern, len(s.Patterns))
+	for i, p := range s.Patterns {
+		clone.Patterns[i] = p.clone()
+	}
+	return &clone
+}
+
+func (m *Model) renderPattern(patternIndex int) (events []smfEvent, numTicks int, duration time.Duration) {
+	r := &Model{
+		song:        m.song.clone(),
+		playPattern: patternIndex,
+	}
+	p := r.song.Patterns[patternIndex]
+	r.trackStates = makeTrackStates(p.NumTracks)
+	beatsPerBar, beatUnit := r.GetTimeSignature(p)
+	events = append(events, timeSignatureEvent(0, beatsPerBar, beatUnit))
+	r.Play()
+	// SMF ticks are our ticks: tempo and speed changes become tempo events
+	ticksPerQuarter := r.playLPB * r.playTPL
+	tempo := [3]int{}
+	maxTicks := p.NumRows * 0x10000
+	for numTicks < maxTicks {
+		tick := numTicks
+		r.processTick(func(msg MidiMessage) {
+			events = append(events, smfEvent{tick, slices.Clone(msg.bytes())})
+		})
+		if newTempo := [3]int{r.playBPM, r.playLPB, r.playTPL}; newTempo != tempo {
+			tempo = newTempo
+			events = append(events, tempoEvent(tick, 60000000*ticksPerQuarter/(r.playBPM*r.playLPB*r.playTPL)))
+		}
+		duration += getTickDuration(r.playBPM, r.playLPB, r.playTPL)
+		numTicks++
+		if r.playRow == 0 && r.playTick == 0 {
+			break
+		}
+	}
+	for i := range r.trackStates {
+		r.arpNoteOff(&r.trackStates[i], func(msg MidiMessage) {
+			events = append(events, smfEvent{numTicks, slices.Clone(msg.bytes())})
+		})
+	}
+	// let pending echoes ring out after the end of the pattern
+	for _, s := range r.scheduled {
+		tick := numTicks + s.tick - r.tickCount
+		events = append(events, smfEvent{tick, slices.Clone(s.msg.bytes())})
+		numTicks = max(numTicks, tick+1)
+	}
+	return events, numTicks, duration
+}
+
+func (m *Model) ExportSMF(filename string) error {
+	ticksPerQuarter := m.GetTicksPerBeat()
+	if ticksPerQuarter >= 0x8000 {
+		return fmt.Errorf("too many ticks per beat for SMF: %d", ticksPerQuarter)
+	}
+	events, numTicks, _ := m.renderPattern(m.editPattern)
+	slices.SortStableFunc(events, func(a, b smfEvent) int {
+		return a.tick - b.tick
+	})
+	var track bytes.Buffer
+	lastTick := 0
+	for _, ev := range events {
+		writeVarLen(&track, ev.tick-lastTick)
+		track.Write(ev.data)
+		lastTick = ev.tick
+	}
+	writeVarLen(&track, numTicks-lastTick)
+	track.Write([]byte{0xff, 0x2f, 0x00})
+	var buf bytes.Buffer
+	buf.WriteString("MThd")
+	binary.Write(&buf, binary.BigEndian, uint32(6))
+	binary.Write(&buf, binary.BigEndian, uint16(0)) // format 0
+	binary.Write(&buf, binary.BigEndian, uint16(1)) // one track
+	binary.Write(&buf, binary.BigEndian, uint16(ticksPerQuarter))
+	buf.WriteString("MTrk")
+	binary.Write(&buf, binary.BigEndian, uint32(track.Len()))
+	buf.Write(track.Bytes())
+	return os.WriteFile(filename, buf.Bytes(), 0o644)
+}
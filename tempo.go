@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// pattern data can change the playback tempo with these commands
+//
+// They use the status bytes left undefined by the MIDI spec, so they
+// never collide with real messages and are never sent out. The value
+// is split into two 7-bit data bytes: msg[1]<<7 | msg[2]
+const (
+	CmdSetBPM = 0xF4
+	CmdSetLPB = 0xF5
+	CmdSetTPL = 0xF9
+
+	maxCommandValue = 0x3fff
+)
+
+func commandValue(msg MidiMessage) int {
+	return int(msg[1]&0x7f)<<7 | int(msg[2]&0x7f)
+}
+
+func setCommandValue(msg *MidiMessage, value int) {
+	msg[1] = byte(value>>7) & 0x7f
+	msg[2] = byte(value) & 0x7f
+}
+
+func getFramesPerTick(sampleRate, bpm, lpb, tpl int) int {
+	bps := float64(bpm) / 60.0
+	tpb := float64(tpl * lpb)
+	return max(1, int(math.Round(float64(sampleRate)/bps/tpb)))
+}
+
+func getTickDuration(bpm, lpb, tpl int) time.Duration {
+	return time.Duration(float64(time.Minute) / float64(bpm*lpb*tpl))
+}
+
+func (m *Model) GetPlayFramesPerTick() int {
+	return getFramesPerTick(m.GetSampleRate(), m.playBPM, m.playLPB, m.playTPL)
+}
+
+func (m *Model) playCommandMessage(msg MidiMessage) {
+	value := commandValue(msg)
+	if value == 0 {
+		return
+	}
+	switch msg[0] {
+	case CmdSetBPM:
+		m.playBPM = value
+	case CmdSetLPB:
+		m.playLPB = value
+	case CmdSetTPL:
+		m.playTPL = value
+	}
+}
+
+// GetPatternDuration renders the pattern once and caches the result
+// until the song is edited
+func (m *Model) GetPatternDuration(patternIndex int) time.Duration {
+	if duration, ok := m.patternDurations[patternIndex]; ok {
+		return duration
+	}
+	_, _, duration := m.renderPattern(patternIndex)
+	if m.patternDurations == nil {
+		m.patternDurations = make(map[int]time.Duration)
+	}
+	m.patternDurations[patternIndex] = duration
+	return duration
+}
+
+func (m *Model) invalidatePatternDurations() {
+	clear(m.patternDurations)
+}
+
+func formatDuration(d time.Duration) string {
+	minutes := int(d / time.Minute)
+	seconds := (d % time.Minute).Seconds()
+	return fmt.Sprintf("%d:%04.1f", minutes, seconds)
+}
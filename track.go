@@ -0,0 +1,202 @@
+package main
+
+import (
+	"math"
+)
+
+type TrackSettings struct {
+	BendRange     int      `json:"bendRange"`     // pitch wheel range in semitones
+	Glide         int      `json:"glide"`         // portamento time in ticks
+	VibratoSpeed  int      `json:"vibratoSpeed"`  // vibrato period in ticks
+	VibratoDepth  int      `json:"vibratoDepth"`  // vibrato depth in cents
+	Slide         int      `json:"slide"`         // controller slide time in ticks
+	Length        int      `json:"length"`        // loop length in rows (0: pattern length)
+	TPLMul        float64  `json:"tplMul"`        // TPL multiplier (0: 1)
+	ArpOrder      ArpOrder `json:"arpOrder"`      // arpeggiator note order (off: no arpeggio)
+	ArpOctaves    int      `json:"arpOctaves"`    // arpeggio range in octaves (0: 1)
+	ArpRate       int      `json:"arpRate"`       // ticks between arpeggio notes (0: track TPL)
+	ArpGate       int      `json:"arpGate"`       // arpeggio note length in percent of the rate (0: 50)
+	ArpTracks     int      `json:"arpTracks"`     // number of tracks whose notes feed the arpeggiator (0: 1)
+	Mono          bool     `json:"mono"`          // end the sounding note when a new one starts
+	EchoRepeats   int      `json:"echoRepeats"`   // number of echoes of each note
+	EchoDelay     int      `json:"echoDelay"`     // ticks between echoes
+	EchoFeedback  int      `json:"echoFeedback"`  // velocity of each echo in percent of the previous one (0: 50)
+	EchoTranspose int      `json:"echoTranspose"` // transposition of each echo in semitones
+}
+
+type TrackState struct {
+	row         int
+	tick        int
+	loop        int
+	note        int // sounding note or -1
+	channel     byte
+	bend        int // last pitch wheel value sent
+	glideFrom   float64
+	glideTicks  int
+	glideTotal  int
+	vibratoTick int
+	cc          [128]int
+	slideCh     byte
+	slideCC     byte
+	slideFrom   int
+	slideTo     int
+	slideTick   int
+	slideTicks  int
+	condFired   bool
+	arpHeld     []arpNote
+	arpSeq      []arpNote // arpeggio built from arpHeld
+	arpSeqOrder ArpOrder  // order of arpSeq
+	arpSeqOcts  int       // octaves of arpSeq
+	arpChanged  bool      // arpHeld changed since arpSeq was built
+	arpTick     int
+	arpStep     int
+	arpNote     int // sounding arpeggio note or -1
+	arpChannel  byte
+}
+
+func (s *TrackSettings) GetBendRange() int {
+	if s.BendRange > 0 {
+		return s.BendRange
+	}
+	return 2
+}
+
+func (s *TrackSettings) hasPitchEffects() bool {
+	return s.Glide > 0 || (s.VibratoSpeed > 0 && s.VibratoDepth > 0)
+}
+
+func (ts *TrackState) reset() {
+	ts.row = 0
+	ts.tick = 0
+	ts.loop = 0
+	ts.note = -1
+	ts.channel = 0
+	ts.bend = pitchWheelCenter
+	ts.glideTicks = 0
+	ts.vibratoTick = 0
+	for i := range ts.cc {
+		ts.cc[i] = -1
+	}
+	ts.slideTicks = 0
+	ts.condFired = false
+	ts.arpHeld = ts.arpHeld[:0]
+	ts.arpChanged = true
+	ts.arpTick = 0
+	ts.arpStep = 0
+	ts.arpNote = -1
+}
+
+func (m *Model) resetTrackStates(p *Pattern) {
+	for i := range m.trackStates {
+		m.trackStates[i].reset()
+	}
+	for numTrack := range p.NumTracks {
+		ts := m.getTrackState(numTrack)
+		ts.row = m.playRow % m.GetTrackLength(p, numTrack)
+	}
+}
+
+// makeTrackStates allocates the playback state of numTracks tracks
+//
+// The JACK callback never grows m.trackStates (the UI reads it while
+// playing), so every change which adds tracks allocates a bigger slice
+// up front and puts it in place with useTrackStates.
+func makeTrackStates(numTracks int) []TrackState {
+	states := make([]TrackState, numTracks)
+	for i := range states {
+		states[i].reset()
+	}
+	return states
+}
+
+// allocTrackStates returns a slice for useTrackStates if the current
+// one cannot hold numTracks tracks
+func (m *Model) allocTrackStates(numTracks int) []TrackState {
+	if numTracks <= len(m.trackStates) {
+		return nil
+	}
+	return makeTrackStates(numTracks)
+}
+
+func (m *Model) useTrackStates(states []TrackState) {
+	if len(states) > len(m.trackStates) {
+		copy(states, m.trackStates)
+		m.trackStates = states
+	}
+}
+
+func (s *Song) maxNumTracks() int {
+	numTracks := 0
+	for _, p := range s.Patterns {
+		if p != nil {
+			numTracks = max(numTracks, p.NumTracks)
+		}
+	}
+	return numTracks
+}
+
+func (m *Model) getTrackState(numTrack int) *TrackState {
+	return &m.trackStates[numTrack]
+}
+
+func (m *Model) GetTrackLength(p *Pattern, numTrack int) int {
+	length := p.TrackSettings[numTrack].Length
+	if length <= 0 || length > p.NumRows {
+		return p.NumRows
+	}
+	return length
+}
+
+func (m *Model) GetTrackTPL(p *Pattern, numTrack int) int {
+	return p.TrackSettings[numTrack].scaleTPL(m.playTPL)
+}
+
+func (s *TrackSettings) scaleTPL(tpl int) int {
+	if s.TPLMul <= 0 {
+		return tpl
+	}
+	return max(1, int(math.Round(float64(tpl)*s.TPLMul)))
+}
+
+func (m *Model) GetTrackPlayRow(p *Pattern, numTrack int) int {
+	if m.isPlaying && numTrack < len(m.trackStates) {
+		return m.trackStates[numTrack].row
+	}
+	return m.playRow % m.GetTrackLength(p, numTrack)
+}
+
+func (m *Model) processTrackTick(p *Pattern, numTrack int, emit func(MidiMessage)) (advanced bool) {
+	ts := m.getTrackState(numTrack)
+	length := m.GetTrackLength(p, numTrack)
+	if ts.row >= length {
+		ts.row = 0
+	}
+	tpl := m.GetTrackTPL(p, numTrack)
+	attrs := p.Attrs[ts.row][numTrack]
+	if ts.tick == min(m.GetRowDelay(p, ts.row, tpl)+attrs.Delay, tpl-1) {
+		msg := applyTrackDefaults(p.Rows[ts.row][numTrack], p.TrackDefaults[numTrack])
+		if msg[0] >= 0xF0 {
+			if m.evalCondition(attrs.Cond, ts) {
+				m.playCommandMessage(msg)
+			}
+		} else if msg[0] >= 0x80 && m.evalCondition(attrs.Cond, ts) {
+			p.TrackDefaults[numTrack] = msg
+			msg = scaleVelocity(msg, m.GetRowVelocityScale(ts.row))
+			m.playTrackMessage(p, numTrack, msg, emit)
+			if msg[0]>>4 == 0x9 && msg[2] != 0 && attrs.hasGate() {
+				m.scheduleNoteOff(p, numTrack, msg, attrs)
+			}
+		}
+	}
+	ts.tick++
+	if ts.tick >= tpl {
+		ts.tick = 0
+		ts.row++
+		if ts.row >= length {
+			ts.row = 0
+			ts.loop++
+		}
+		advanced = true
+	}
+	return advanced
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+)
+
+func (m *Model) selectedTracks() (firstTrack, lastTrack int) {
+	return m.sel.X / 6, (m.sel.X + m.sel.W - 1) / 6
+}
+
+func isNoteStatus(status byte) bool {
+	switch status >> 4 {
+	case 0x8, 0x9, 0xA:
+		return true
+	}
+	return false
+}
+
+func (m *Model) transposeNote(note byte, amount int, byDegrees bool) byte {
+	var result int
+	if byDegrees && !m.song.Chromatic {
+		degree, offset := m.MidiNoteToDegree(int(note))
+		result = m.DegreeToMidiNote(degree+amount) + offset
+	} else {
+		result = int(note) + amount
+	}
+	return byte(max(0, min(result, 127)))
+}
+
+func (m *Model) replaceEditPatternWith(transform func(p, clone *Pattern)) {
+	p := m.song.Patterns[m.editPattern]
+	clone := p.clone()
+	transform(p, clone)
+	m.submitAction(
+		func() {
+			m.ReplaceEditPattern(clone)
+		},
+		func() {
+			m.ReplaceEditPattern(p)
+		},
+		0,
+	)
+}
+
+func (m *Model) TransposeSelection(amount int, byDegrees bool) {
+	sel := m.sel
+	firstTrack, lastTrack := m.selectedTracks()
+	m.replaceEditPatternWith(func(p, clone *Pattern) {
+		for y := sel.Y; y < sel.Y+sel.H; y++ {
+			for t := firstTrack; t <= lastTrack; t++ {
+				msg := &clone.Rows[y][t]
+				if msg[0] == 0 && msg[1] == 0 {
+					continue
+				}
+				if !isNoteStatus(p.resolveStatus(y, t)) {
+					continue
+				}
+				msg[1] = m.transposeNote(msg[1], amount, byDegrees)
+			}
+		}
+	})
+}
+
+type Curve int
+
+const (
+	CurveLinear Curve = iota
+	CurveExponential
+	CurveLogarithmic
+)
+
+func parseCurve(s string) (Curve, error) {
+	switch s {
+	case "lin", "linear":
+		return CurveLinear, nil
+	case "exp", "exponential":
+		return CurveExponential, nil
+	case "log", "logarithmic":
+		return CurveLogarithmic, nil
+	}
+	return CurveLinear, fmt.Errorf("invalid curve: %s", s)
+}
+
+func (c Curve) apply(f float64) float64 {
+	switch c {
+	case CurveExponential:
+		return (math.Exp2(4*f) - 1) / 15
+	case CurveLogarithmic:
+		return math.Log2(1+15*f) / 4
+	}
+	return f
+}
+
+func lerp(a, b int, f float64) int {
+	return a + int(math.Round(float64(b-a)*f))
+}
+
+func interpolateMessage(from, to MidiMessage, pitchWheel bool, f float64) MidiMessage {
+	msg := MidiMessage{from[0], 0, 0}
+	if pitchWheel {
+		value := lerp(int(from[2])<<7|int(from[1]), int(to[2])<<7|int(to[1]), f)
+		msg[1] = byte(value & 0x7f)
+		msg[2] = byte(value >> 7)
+	} else {
+		msg[1] = byte(lerp(int(from[1]), int(to[1]), f))
+		msg[2] = byte(lerp(int(from[2]), int(to[2]), f))
+	}
+	return msg
+}
+
+func (m *Model) InterpolateSelection(curve Curve) {
+	sel := m.sel
+	firstTrack, lastTrack := m.selectedTracks()
+	m.replaceEditPatternWith(func(p, clone *Pattern) {
+		for t := firstTrack; t <= lastTrack; t++ {
+			first, last := -1, -1
+			for y := sel.Y; y < sel.Y+sel.H; y++ {
+				if p.Rows[y][t] != (MidiMessage{}) {
+					if first < 0 {
+						first = y
+					}
+					last = y
+				}
+			}
+			if first < 0 || last-first < 2 {
+				continue
+			}
+			from := p.Rows[first][t]
+			to := p.Rows[last][t]
+			pitchWheel := p.resolveStatus(first, t)>>4 == 0xE
+			for y := first + 1; y < last; y++ {
+				f := curve.apply(float64(y-first) / float64(last-first))
+				clone.Rows[y][t] = interpolateMessage(from, to, pitchWheel, f)
+				clone.Attrs[y][t] = CellAttrs{}
+			}
+		}
+	})
+}
+
+// HumanizeSelection randomizes velocities by up to ±velocityAmount and
+// delays events by 0..delayAmount ticks, events are never moved early
+// as playback only fires a cell during its own row
+func (m *Model) HumanizeSelection(velocityAmount, delayAmount int, seed int64) {
+	sel := m.sel
+	firstTrack, lastTrack := m.selectedTracks()
+	m.replaceEditPatternWith(func(p, clone *Pattern) {
+		rng := rand.New(rand.NewSource(seed))
+		for y := sel.Y; y < sel.Y+sel.H; y++ {
+			for t := firstTrack; t <= lastTrack; t++ {
+				msg := &clone.Rows[y][t]
+				if *msg == (MidiMessage{}) {
+					continue
+				}
+				resolved := *msg
+				resolved[0] = p.resolveStatus(y, t)
+				if !isNoteStatus(resolved[0]) || resolved.length() != 3 {
+					continue
+				}
+				if velocityAmount > 0 && resolved[0]>>4 == 0x9 && msg[2] != 0 {
+					velocity := int(msg[2]) + rng.Intn(2*velocityAmount+1) - velocityAmount
+					msg[2] = byte(max(1, min(velocity, 127)))
+				}
+				if delayAmount > 0 {
+					clone.Attrs[y][t].Delay = rng.Intn(delayAmount + 1)
+				}
+			}
+		}
+	})
+}
+
+// resolveRows makes the implicit values of the events in rows y0..y1-1
+// of tracks t0..t1 explicit, together with the first event below them
+// which would otherwise inherit from the last row of the range
+func resolveRows(p, clone *Pattern, y0, y1, t0, t1 int) {
+	for t := t0; t <= t1; t++ {
+		defaults := p.TrackDefaults[t]
+		for y := range p.NumRows {
+			msg := p.Rows[y][t]
+			if y >= y0 {
+				clone.Rows[y][t] = applyTrackDefaults(msg, defaults)
+				if y >= y1 && msg != (MidiMessage{}) {
+					break
+				}
+			}
+			defaults = nextTrackDefaults(msg, defaults)
+		}
+	}
+}
+
+// transformBlock reorders the rows of the selection, the events are
+// resolved first so that they keep their status and values wherever
+// they end up and the attributes of the selected tracks move with them
+func (m *Model) transformBlock(transform func(block Block, attrs [][]CellAttrs)) {
+	sel := m.sel
+	firstTrack, lastTrack := m.selectedTracks()
+	m.replaceEditPatternWith(func(p, clone *Pattern) {
+		resolveRows(p, clone, sel.Y, sel.Y+sel.H, firstTrack, lastTrack)
+		block := clone.getBlock(sel)
+		attrs := make([][]CellAttrs, sel.H)
+		for dy := range attrs {
+			attrs[dy] = slices.Clone(clone.Attrs[sel.Y+dy][firstTrack : lastTrack+1])
+		}
+		transform(block, attrs)
+		clone.setBlock(sel, block)
+		for dy, row := range attrs {
+			copy(clone.Attrs[sel.Y+dy][firstTrack:], row)
+		}
+	})
+}
+
+func rotateRows[S ~[]E, E any](rows S, n int) {
+	if len(rows) == 0 {
+		return
+	}
+	_, k := floorDivMod(-n, len(rows))
+	rotated := append(slices.Clone(rows[k:]), rows[:k]...)
+	copy(rows, rotated)
+}
+
+func (m *Model) ReverseSelection() {
+	m.transformBlock(func(block Block, attrs [][]CellAttrs) {
+		slices.Reverse(block)
+		slices.Reverse(attrs)
+	})
+}
+
+func (m *Model) RotateSelection(n int) {
+	m.transformBlock(func(block Block, attrs [][]CellAttrs) {
+		rotateRows(block, n)
+		rotateRows(attrs, n)
+	})
+}
+
+func (m *Model) invertNote(note byte, pivot int) byte {
+	var result int
+	if m.song.Chromatic {
+		result = 2*pivot - int(note)
+	} else {
+		pivotDegree, _ := m.MidiNoteToDegree(pivot)
+		degree, offset := m.MidiNoteToDegree(int(note))
+		result = m.DegreeToMidiNote(2*pivotDegree-degree) - offset
+	}
+	return byte(max(0, min(result, 127)))
+}
+
+// InvertSelection mirrors the notes of the selection around pivot (or
+// around the first note of the selection if pivot is negative)
+func (m *Model) InvertSelection(pivot int) {
+	sel := m.sel
+	firstTrack, lastTrack := m.selectedTracks()
+	m.replaceEditPatternWith(func(p, clone *Pattern) {
+		resolveRows(p, clone, sel.Y, sel.Y+sel.H, firstTrack, lastTrack)
+		for y := sel.Y; y < sel.Y+sel.H; y++ {
+			for t := firstTrack; t <= lastTrack; t++ {
+				msg := &clone.Rows[y][t]
+				if p.Rows[y][t] == (MidiMessage{}) || !isNoteStatus(msg[0]) {
+					continue
+				}
+				if pivot < 0 {
+					pivot = int(msg[1])
+				}
+				msg[1] = m.invertNote(msg[1], pivot)
+			}
+		}
+	})
+}
+
+type CollisionPolicy int
+
+const (
+	KeepFirst CollisionPolicy = iota
+	KeepLoudest
+	SpillToFreeTrack
+)
+
+func parseCollisionPolicy(s string) (CollisionPolicy, bool) {
+	switch s {
+	case "first":
+		return KeepFirst, true
+	case "loudest":
+		return KeepLoudest, true
+	case "spill":
+		return SpillToFreeTrack, true
+	}
+	return KeepFirst, false
+}
+
+// stretchRows moves the events of rows y0..y1-1 in tracks t0..t1 of
+// src to scaled row positions in dst, which must be empty there
+//
+// Events which land at or after row yEnd are dropped, spilled events
+// only go to free cells in t0..t1. Returns the number of events lost
+// this way (collisions resolved by the policy are not counted).
+func stretchRows(src, dst *Pattern, y0, y1, yEnd, t0, t1 int, ratio float64, policy CollisionPolicy) (dropped int) {
+	// events lose their neighbours, so they move with explicit values
+	resolved := src.clone()
+	resolveRows(src, resolved, y0, y1, t0, t1)
+	for y := y0; y < y1; y++ {
+		dy := y0 + int(math.Floor(float64(y-y0)*ratio))
+		for t := t0; t <= t1; t++ {
+			msg := resolved.Rows[y][t]
+			if msg == (MidiMessage{}) {
+				continue
+			}
+			if dy >= yEnd {
+				dropped++
+				continue
+			}
+			attrs := src.Attrs[y][t]
+			target := &dst.Rows[dy][t]
+			switch {
+			case *target == (MidiMessage{}):
+			case policy == KeepLoudest && msg[2] > target[2]:
+			case policy == SpillToFreeTrack:
+				target = nil
+				for i := 1; i <= t1-t0; i++ {
+					u := t0 + (t-t0+i)%(t1-t0+1)
+					if dst.Rows[dy][u] == (MidiMessage{}) {
+						target = &dst.Rows[dy][u]
+						dst.Attrs[dy][u] = attrs
+						break
+					}
+				}
+				if target == nil {
+					dropped++
+					continue
+				}
+				*target = msg
+				continue
+			default:
+				continue
+			}
+			*target = msg
+			dst.Attrs[dy][t] = attrs
+		}
+	}
+	return dropped
+}
+
+// StretchSelection scales the row positions of the selected events, the
+// selection does not grow: events stretched past its end are dropped
+func (m *Model) StretchSelection(ratio float64, policy CollisionPolicy) {
+	sel := m.sel
+	firstTrack, lastTrack := m.selectedTracks()
+	dropped := 0
+	m.replaceEditPatternWith(func(p, clone *Pattern) {
+		for y := sel.Y; y < sel.Y+sel.H; y++ {
+			for t := firstTrack; t <= lastTrack; t++ {
+				clone.Rows[y][t] = MidiMessage{}
+				clone.Attrs[y][t] = CellAttrs{}
+			}
+		}
+		dropped = stretchRows(p, clone, sel.Y, sel.Y+sel.H, sel.Y+sel.H, firstTrack, lastTrack, ratio, policy)
+		resolveRows(p, clone, sel.Y+sel.H, sel.Y+sel.H, firstTrack, lastTrack)
+	})
+	if dropped > 0 {
+		m.SetError(fmt.Errorf("%d events dropped by stretch", dropped))
+	}
+}
+
+// StretchPattern stretches the whole pattern, resizing it and scaling
+// LPB and the track loop lengths so that the events keep their timing
+// when possible
+func (m *Model) StretchPattern(ratio float64, policy CollisionPolicy) {
+	p := m.song.Patterns[m.editPattern]
+	numRows := max(1, int(math.Round(float64(p.NumRows)*ratio)))
+	clone := p.clone().withNumRows(numRows)
+	for y := range clone.NumRows {
+		for t := range clone.NumTracks {
+			clone.Rows[y][t] = MidiMessage{}
+			clone.Attrs[y][t] = CellAttrs{}
+		}
+	}
+	dropped := stretchRows(p, clone, 0, p.NumRows, clone.NumRows, 0, p.NumTracks-1, ratio, policy)
+	for t := range clone.NumTracks {
+		if length := clone.TrackSettings[t].Length; length > 0 {
+			clone.TrackSettings[t].Length = max(1, int(math.Round(float64(length)*ratio)))
+		}
+	}
+	oldLPB := m.song.LPB
+	newLPB := oldLPB
+	if lpb := float64(oldLPB) * ratio; lpb >= 1 && lpb == math.Trunc(lpb) {
+		newLPB = int(lpb)
+	}
+	m.submitAction(
+		func() {
+			m.song.LPB = newLPB
+			m.playLPB = newLPB
+			m.ReplaceEditPattern(clone)
+		},
+		func() {
+			m.song.LPB = oldLPB
+			m.playLPB = oldLPB
+			m.ReplaceEditPattern(p)
+		},
+		0,
+	)
+	if dropped > 0 {
+		m.SetError(fmt.Errorf("%d events dropped by stretch", dropped))
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
+	"math/rand"
+	"time"
 )
 
 type (
@@ -11,21 +13,38 @@ type (
 )
 
 type Pattern struct {
-	Rows          []Row `json:"rows"`
-	NumRows       int   `json:"numRows"`
-	NumTracks     int   `json:"numTracks"`
-	TrackDefaults Row   `json:"trackDefaults"`
+	Rows          []Row           `json:"rows"`
+	NumRows       int             `json:"numRows"`
+	NumTracks     int             `json:"numTracks"`
+	TrackDefaults Row             `json:"trackDefaults"`
+	Swing         *int            `json:"swing,omitempty"`       // overrides Song.Swing
+	BeatsPerBar   int             `json:"beatsPerBar,omitempty"` // overrides Song.BeatsPerBar
+	BeatUnit      int             `json:"beatUnit,omitempty"`    // overrides Song.BeatUnit
+	TrackSettings []TrackSettings `json:"trackSettings"`
+	Attrs         [][]CellAttrs   `json:"attrs"`
+}
+
+type CellAttrs struct {
+	Cond      Condition `json:"cond,omitzero"`
+	Delay     int       `json:"delay,omitzero"`     // in ticks after the start of the row (never early)
+	GateRows  int       `json:"gateRows,omitzero"`  // note length in rows
+	GateTicks int       `json:"gateTicks,omitzero"` // note length in ticks added to GateRows
 }
 
 type Song struct {
-	BPM       int        `json:"bpm"` // beats per minute
-	LPB       int        `json:"lpb"` // lines per beat
-	TPL       int        `json:"tpl"` // ticks per line
-	Patterns  []*Pattern `json:"patterns"`
-	Root      int        `json:"root"`      // root note
-	Scale     ScaleId    `json:"scale"`     // scale id
-	Mode      int        `json:"mode"`      // offset of degree 0 within the scale
-	Chromatic bool       `json:"chromatic"` // note mode uses chromatic scale?
+	BPM         int        `json:"bpm"` // beats per minute
+	LPB         int        `json:"lpb"` // lines per beat
+	TPL         int        `json:"tpl"` // ticks per line
+	Patterns    []*Pattern `json:"patterns"`
+	Root        int        `json:"root"`      // root note
+	Scale       ScaleId    `json:"scale"`     // scale id
+	Mode        int        `json:"mode"`      // offset of degree 0 within the scale
+	Chromatic   bool       `json:"chromatic"` // note mode uses chromatic scale?
+	Swing       int        `json:"swing"`     // delay of every second line in percent of a line
+	Groove      *Groove    `json:"groove,omitempty"`
+	Seed        int64      `json:"seed"`        // seed of the playback RNG
+	BeatsPerBar int        `json:"beatsPerBar"` // time signature numerator
+	BeatUnit    int        `json:"beatUnit"`    // time signature denominator
 }
 
 type Point struct {
@@ -57,15 +76,18 @@ type ActionFunction func()
 type Action struct {
 	doFn   ActionFunction
 	undoFn ActionFunction
+	burst  int // actions of the same burst are undone together
 }
 
 type Mode int
 
 const (
-	EditMode    Mode = 0
-	SelectMode  Mode = 1
-	NoteMode    Mode = 2
-	CommandMode Mode = 3
+	EditMode     Mode = 0
+	SelectMode   Mode = 1
+	NoteMode     Mode = 2
+	CommandMode  Mode = 3
+	DefaultsMode Mode = 4
+	DecimalMode  Mode = 5
 )
 
 type Model struct {
@@ -86,6 +108,15 @@ type Model struct {
 	playRow             int
 	playTick            int
 	playFrame           uint64
+	nextTickFrame       uint64
+	playBPM             int
+	playLPB             int
+	playTPL             int
+	trackStates         []TrackState
+	tickCount           int
+	scheduled           []scheduledMessage
+	releaseMessages     []MidiMessage
+	rng                 *rand.Rand
 	isPlaying           bool
 	playFromRow         int
 	commandModel        textinput.Model
@@ -96,8 +127,22 @@ type Model struct {
 	undoableActions     []Action
 	undoneActions       []Action
 	clipboard           Block
+	clipboardAttrs      [][]CellAttrs
 	pasteOffset         int
 	usingTempBrush      bool
+	chord               Chord
+	chordMode           bool
+	noteOctave          int // octave offset of note entry relative to the root
+	entryVelocity       int // velocity written by note entry (0: none)
+	editStep            int // rows to advance after note entry
+	displayMode         DisplayMode
+	smartCursor         bool
+	noteField           int // byte of the cell edited in note mode with smart cursor
+	decimalPos          Point
+	decimalInput        string
+	incrementBurst      incrementBurst
+	patternDurations    map[int]time.Duration
+	cellStatuses        cellStatusCache
 }
 
 type (
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/lucasb-eyer/go-colorful"
+	"slices"
 )
 
 type Colors struct {
@@ -27,8 +28,14 @@ type Colors struct {
 	playText colorful.Color
 	beatFill colorful.Color
 	beatText colorful.Color
+	barFill  colorful.Color
+	barText  colorful.Color
 	noteFill colorful.Color
 	noteText colorful.Color
+	condFill colorful.Color
+	condText colorful.Color
+
+	ghostText colorful.Color
 
 	errorFill colorful.Color
 	errorText colorful.Color
@@ -43,9 +50,13 @@ const (
 	playBit   = 8
 	beatBit   = 16
 	noteBit   = 32
+	condBit   = 64
+	barBit    = 128
+	ghostBit  = 256
+	errorBit  = 512
 )
 
-var patternPalette [64]lipgloss.Style
+var patternPalette [1024]lipgloss.Style
 
 type Styles struct {
 	chrome      lipgloss.Style
@@ -89,8 +100,14 @@ func init() {
 	colors.playText = colors.cursorText
 	colors.beatFill = colorful.Hcl(40, 0.10, 0.20)
 	colors.beatText = colors.cursorText
+	colors.barFill = colorful.Hcl(40, 0.12, 0.28)
+	colors.barText = colors.cursorText
 	colors.noteFill = colorful.Hcl(70, 0.12, 0.40)
 	colors.noteText = colors.cursorText
+	colors.condFill = colorful.Hcl(300, 0.10, 0.30)
+	colors.condText = colors.cursorText
+
+	colors.ghostText = modColor(colors.patternText, 0, -0.45)
 
 	colors.errorFill = colorful.Hcl(25, 0.30, 0.20)
 	colors.errorText = colorful.Hcl(25, 0.14, 0.88)
@@ -118,10 +135,25 @@ func init() {
 			text = text.BlendHcl(colors.beatText, 0.5)
 			fill = fill.BlendHcl(colors.beatFill, 0.5)
 		}
+		if i&barBit > 0 {
+			text = text.BlendHcl(colors.barText, 0.5)
+			fill = fill.BlendHcl(colors.barFill, 0.5)
+		}
 		if i&noteBit > 0 {
 			text = text.BlendHcl(colors.noteText, 0.5)
 			fill = fill.BlendHcl(colors.noteFill, 0.5)
 		}
+		if i&condBit > 0 {
+			text = text.BlendHcl(colors.condText, 0.5)
+			fill = fill.BlendHcl(colors.condFill, 0.5)
+		}
+		if i&ghostBit > 0 {
+			text = text.BlendHcl(colors.ghostText, 0.7)
+		}
+		if i&errorBit > 0 {
+			text = text.BlendHcl(colors.errorText, 0.5)
+			fill = fill.BlendHcl(colors.errorFill, 0.5)
+		}
 		patternPalette[i] = lipgloss.Style{}.Foreground(LGC(text)).Background(LGC(fill))
 	}
 
@@ -193,6 +225,25 @@ func (m *Model) HeaderView() string {
 	rb.WriteString("TPL:")
 	rb.SetStyle(&styles.headerValue)
 	rb.WriteString(fmt.Sprintf("%d", m.song.TPL))
+	rb.WriteByte(' ')
+	rb.SetStyle(&styles.headerLabel)
+	rb.WriteString("SIG:")
+	rb.SetStyle(&styles.headerValue)
+	beatsPerBar, beatUnit := m.GetTimeSignature(m.song.Patterns[m.editPattern])
+	rb.WriteString(fmt.Sprintf("%d/%d", beatsPerBar, beatUnit))
+	rb.WriteByte(' ')
+	rb.SetStyle(&styles.headerLabel)
+	rb.WriteString("DUR:")
+	rb.SetStyle(&styles.headerValue)
+	rb.WriteString(formatDuration(m.GetPatternDuration(m.editPattern)))
+	p := m.song.Patterns[m.editPattern]
+	if attrs := p.Attrs[m.editPos.Y][m.editPos.X/6]; attrs != (CellAttrs{}) {
+		rb.WriteByte(' ')
+		rb.SetStyle(&styles.headerLabel)
+		rb.WriteString("CELL:")
+		rb.SetStyle(&styles.headerValue)
+		rb.WriteString(attrs.String())
+	}
 	if m.mode == NoteMode {
 		rb.WriteByte(' ')
 		rb.SetStyle(&styles.headerLabel)
@@ -202,6 +253,28 @@ func (m *Model) HeaderView() string {
 		rb.WriteByte(' ')
 		rb.WriteString(m.GetScaleCode())
 		rb.WriteString(fmt.Sprintf("+%d", m.song.Mode))
+		rb.WriteByte(' ')
+		rb.SetStyle(&styles.headerLabel)
+		rb.WriteString("OCT:")
+		rb.SetStyle(&styles.headerValue)
+		rb.WriteString(fmt.Sprintf("%+d", m.noteOctave))
+		rb.WriteByte(' ')
+		rb.SetStyle(&styles.headerLabel)
+		rb.WriteString("VEL:")
+		rb.SetStyle(&styles.headerValue)
+		rb.WriteString(fmt.Sprintf("%02X", m.entryVelocity))
+		rb.WriteByte(' ')
+		rb.SetStyle(&styles.headerLabel)
+		rb.WriteString("STEP:")
+		rb.SetStyle(&styles.headerValue)
+		rb.WriteString(fmt.Sprintf("%d", m.editStep))
+		if m.chordMode {
+			rb.WriteByte(' ')
+			rb.SetStyle(&styles.headerLabel)
+			rb.WriteString("CHD:")
+			rb.SetStyle(&styles.headerValue)
+			rb.WriteString(m.chord.String())
+		}
 	}
 	return rb.String()
 }
@@ -212,6 +285,7 @@ func (m *Model) PatternView(r Rect) string {
 	numPatternTracks := p.NumTracks
 	patternHeight := r.H
 	patternHeight -= 2 // borders
+	patternHeight -= 1 // track defaults
 	patternWidth := r.W
 	patternWidth -= 2 // borders
 	patternWidth -= 2 // padding
@@ -253,18 +327,46 @@ func (m *Model) PatternView(r Rect) string {
 	var rb RowBuilder
 	rowStrings := make([]string, 0, patternHeight)
 	editTrackBegin := m.editPos.X - m.editPos.X%trackWidth
+	rowsPerBar := m.GetRowsPerBar(p)
+	rb.SetStyle(&styles.patternNum)
+	rb.WriteString("DEFS")
+	rb.WriteByte(' ')
+	for t := m.firstVisibleTrack; t < min(numPatternTracks, m.firstVisibleTrack+visibleTracks); t++ {
+		rb.SetStyle(&patternPalette[0])
+		if t > m.firstVisibleTrack {
+			rb.WriteByte(' ')
+		}
+		text := formatCellHex(p.TrackDefaults[t])
+		for i := range trackWidth {
+			cellStyleIndex := 0
+			if m.mode == DefaultsMode && t*trackWidth+i == m.editPos.X {
+				cellStyleIndex |= cursorBit
+			}
+			rb.SetStyle(&patternPalette[cellStyleIndex])
+			rb.WriteRune(text[i])
+		}
+	}
+	rowStrings = append(rowStrings, rb.String())
+	rb.Reset()
+	// inherited values are shown as they would be resolved by playback
+	defaults := slices.Clone(p.TrackDefaults)
+	for y := range m.firstVisibleRow {
+		for t := range numPatternTracks {
+			defaults[t] = nextTrackDefaults(p.Rows[y][t], defaults[t])
+		}
+	}
 	for y := m.firstVisibleRow; y < min(numPatternRows, m.firstVisibleRow+patternHeight); y++ {
 		row := p.Rows[y]
 		rb.SetStyle(&styles.patternNum)
 		rb.WriteString(fmt.Sprintf("%04X", y))
 		rb.WriteByte(' ')
 		rowStyleIndex := 0
-		if y == m.playRow {
-			rowStyleIndex |= playBit
-		}
 		if y%m.song.LPB == 0 {
 			rowStyleIndex |= beatBit
 		}
+		if y%rowsPerBar == 0 {
+			rowStyleIndex |= barBit
+		}
 		x := m.firstVisibleTrack * trackWidth
 		for t := m.firstVisibleTrack; t < min(numPatternTracks, m.firstVisibleTrack+visibleTracks); t++ {
 			rb.SetStyle(&patternPalette[rowStyleIndex])
@@ -272,19 +374,47 @@ func (m *Model) PatternView(r Rect) string {
 				rb.WriteByte(' ')
 			}
 			msg := row[t]
+			trackStyleIndex := rowStyleIndex
+			if y == m.GetTrackPlayRow(p, t) {
+				trackStyleIndex |= playBit
+			}
+			if p.Attrs[y][t] != (CellAttrs{}) {
+				trackStyleIndex |= condBit
+			}
+			ghost := applyTrackDefaults(msg, defaults[t])
+			if lintMessage(msg, ghost) != "" {
+				trackStyleIndex |= errorBit
+			}
+			defaults[t] = nextTrackDefaults(msg, defaults[t])
+			var text []rune
+			readable := m.displayMode == DisplayReadable && (m.mode == NoteMode || y != m.editPos.Y || t != m.editPos.X/6)
+			if readable {
+				text = formatCell(ghost, ghost[0])
+			} else {
+				text = formatCellHex(ghost)
+			}
+			ghostMask := getGhostMask(msg, ghost, readable)
+			if m.mode == DecimalMode && y == m.decimalPos.Y && t == m.decimalPos.X/6 {
+				text = []rune(fmt.Sprintf("=%-5s", m.decimalInput))
+				ghostMask = [6]bool{}
+			}
 			x0 := x
 			for i := range 3 {
 				for j := range 2 {
-					cellStyleIndex := rowStyleIndex
+					cellStyleIndex := trackStyleIndex
 					if m.mode == NoteMode {
-						if i == 1 && x0 == editTrackBegin {
+						noteField := 1
+						if m.smartCursor {
+							noteField = m.noteField
+						}
+						if i == noteField && x0 == editTrackBegin {
 							cellStyleIndex |= noteBit
 							if y == m.editPos.Y {
 								cellStyleIndex |= cursorBit
 							}
 						}
 					} else {
-						if y == m.editPos.Y && x == m.editPos.X {
+						if y == m.editPos.Y && x == m.editPos.X && m.mode != DefaultsMode {
 							cellStyleIndex |= cursorBit
 						}
 						insideBrush := x >= m.brush.X &&
@@ -302,14 +432,11 @@ func (m *Model) PatternView(r Rect) string {
 							cellStyleIndex |= selectBit
 						}
 					}
-					rb.SetStyle(&patternPalette[cellStyleIndex])
-					b := msg[i]
-					if b == 0 {
-						rb.WriteRune('·')
-					} else {
-						shiftBits := (1 - j) * 4
-						rb.WriteByte(hexDigits[(b>>shiftBits)&0x0f])
+					if ghostMask[i*2+j] {
+						cellStyleIndex |= ghostBit
 					}
+					rb.SetStyle(&patternPalette[cellStyleIndex])
+					rb.WriteRune(text[i*2+j])
 					x++
 				}
 			}